@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Право доступа к файлу
+type permission string
+
+const (
+	permRead   permission = "read"
+	permWrite  permission = "write"
+	permDelete permission = "delete"
+)
+
+// Права в порядке значений перечисления Permission
+var permissions = []permission{permRead, permWrite, permDelete}
+
+// Роль, которой разрешены любые действия со всеми файлами
+const adminRole = "admin"
+
+// Запись списка доступа: права пользователя ("user:<имя>")
+// или группы ("group:<роль>") на файл
+type aclEntry struct {
+	Principal   string       `json:"principal"`
+	Permissions []permission `json:"permissions"`
+}
+
+// Метод для проверки, есть ли у пользователя роль
+func (id *identity) hasRole(role string) bool {
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Метод для проверки, относится ли к пользователю запись списка доступа
+func (id *identity) matches(principal string) bool {
+	kind, name, _ := strings.Cut(principal, ":")
+	switch kind {
+	case "user":
+		return name == id.Subject
+	case "group":
+		return id.hasRole(name)
+	}
+	return false
+}
+
+// Метод для проверки, разрешено ли пользователю действие с файлом.
+// Владельцу и администраторам разрешено всё. Файлы без владельца и
+// списка доступа, созданные до включения проверки подлинности, доступны всем
+func (md *fileMetadata) allows(caller *identity, perm permission) bool {
+	if caller.hasRole(adminRole) || md.Owner == caller.Subject {
+		return true
+	}
+	if len(md.Owner) == 0 && len(md.ACL) == 0 {
+		return true
+	}
+	for _, e := range md.ACL {
+		if caller.matches(e.Principal) && containsPermission(e.Permissions, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Функция для проверки, разрешено ли выполняющему запрос действие с
+// файлом. Если проверка подлинности отключена, разрешено всё
+func allowed(ctx context.Context, md *fileMetadata, perm permission) bool {
+	caller, ok := identityFromContext(ctx)
+	return !ok || md.allows(caller, perm)
+}
+
+// Функция для проверки права на действие с файлом
+func checkAccess(ctx context.Context, md *fileMetadata, perm permission) error {
+	if allowed(ctx, md, perm) {
+		return nil
+	}
+	caller, _ := identityFromContext(ctx)
+	return status.Errorf(codes.PermissionDenied, "User %s has no %s permission on file %s", caller.Subject, perm, md.ID)
+}
+
+// Функция для проверки, что запрос выполняет администратор
+func checkAdmin(ctx context.Context) error {
+	caller, ok := identityFromContext(ctx)
+	if !ok || caller.hasRole(adminRole) {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "User %s is not an administrator", caller.Subject)
+}
+
+// Функция для проверки, может ли выполняющий запрос изменять список
+// доступа файла: это разрешено только владельцу и администраторам
+func checkACLManager(ctx context.Context, md *fileMetadata) error {
+	caller, ok := identityFromContext(ctx)
+	if !ok || caller.hasRole(adminRole) || (len(md.Owner) > 0 && md.Owner == caller.Subject) {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "Only the owner of file %s may change its access list", md.ID)
+}
+
+// Функция для проверки наличия права в списке
+func containsPermission(perms []permission, perm permission) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Функция для проверки записи вида "user:<имя>" или "group:<роль>"
+func checkPrincipal(principal string) error {
+	kind, name, _ := strings.Cut(principal, ":")
+	if (kind != "user" && kind != "group") || len(name) == 0 {
+		return status.Errorf(codes.InvalidArgument, "Invalid principal %q: expected user:<name> or group:<name>", principal)
+	}
+	return nil
+}
+
+// Функция для разбора списка доступа из запроса
+func parseACL(entries []*pb.ACLEntry) ([]aclEntry, error) {
+	var acl []aclEntry
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if err := checkPrincipal(e.Principal); err != nil {
+			return nil, err
+		}
+		if seen[e.Principal] {
+			return nil, status.Errorf(codes.InvalidArgument, "Duplicate principal %q", e.Principal)
+		}
+		seen[e.Principal] = true
+
+		entry := aclEntry{Principal: e.Principal}
+		for _, p := range e.Permissions {
+			if int(p) < 0 || int(p) >= len(permissions) {
+				return nil, status.Errorf(codes.InvalidArgument, "Invalid permission %d for %q", p, e.Principal)
+			}
+			if !containsPermission(entry.Permissions, permissions[p]) {
+				entry.Permissions = append(entry.Permissions, permissions[p])
+			}
+		}
+		if len(entry.Permissions) == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "No permissions given for %q", e.Principal)
+		}
+		sort.Slice(entry.Permissions, func(i, j int) bool {
+			return permissionIndex(entry.Permissions[i]) < permissionIndex(entry.Permissions[j])
+		})
+		acl = append(acl, entry)
+	}
+	return acl, nil
+}
+
+// Функция для получения значения перечисления Permission
+func permissionIndex(perm permission) int {
+	for i, p := range permissions {
+		if p == perm {
+			return i
+		}
+	}
+	return -1
+}
+
+// Функция для преобразования списка доступа в сообщения gRPC
+func aclProto(acl []aclEntry) []*pb.ACLEntry {
+	var entries []*pb.ACLEntry
+	for _, e := range acl {
+		entry := &pb.ACLEntry{Principal: e.Principal}
+		for _, p := range e.Permissions {
+			if i := permissionIndex(p); i >= 0 {
+				entry.Permissions = append(entry.Permissions, pb.Permission(i))
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Метод для получения владельца и списка доступа файла
+func (s *server) GetACL(ctx context.Context, req *pb.GetACLRequest) (*pb.GetACLResponse, error) {
+	unlock := s.locks.RLock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupMetadata(ctx, req.Bucket, req.Id, req.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permRead); err != nil {
+		return nil, err
+	}
+
+	return &pb.GetACLResponse{Owner: md.Owner, Entries: aclProto(md.ACL)}, nil
+}
+
+// Метод для замены списка доступа файла
+func (s *server) SetACL(ctx context.Context, req *pb.SetACLRequest) (*pb.SetACLResponse, error) {
+	acl, err := parseACL(req.Entries)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := s.locks.Lock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupMetadata(ctx, req.Bucket, req.Id, req.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkACLManager(ctx, md); err != nil {
+		return nil, err
+	}
+	if err := s.locks.checkLease(md.ID, req.LockToken); err != nil {
+		return nil, err
+	}
+
+	md, err = s.meta.Update(md.ID, func(md *fileMetadata) (*fileMetadata, error) {
+		if md == nil {
+			return nil, errMetadataNotFound
+		}
+		md.ACL = acl
+		return md, nil
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to save metadata: %v", err)
+	}
+
+	return &pb.SetACLResponse{Owner: md.Owner, Entries: aclProto(md.ACL)}, nil
+}
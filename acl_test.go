@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Функция для получения контекста запроса пользователя subject с ролями roles
+func asUser(subject string, roles ...string) context.Context {
+	return context.WithValue(context.Background(), identityKey{}, &identity{Subject: subject, Roles: roles, Method: "api_key"})
+}
+
+// Функция для создания файла от имени выполняющего запрос со списком доступа acl
+func createWithACL(t *testing.T, s *server, ctx context.Context, bucket string, acl []*pb.ACLEntry) string {
+	t.Helper()
+	f, err := s.CreateFile(ctx, &pb.CreateFileRequest{Bucket: bucket, File: []byte("shared file")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acl) > 0 {
+		if _, err := s.SetACL(ctx, &pb.SetACLRequest{Bucket: bucket, Id: f.Id, Entries: acl}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f.Id
+}
+
+// Функция для проверки, есть ли файл id в списке файлов бакета
+func listed(t *testing.T, s *server, ctx context.Context, bucket, id string) bool {
+	t.Helper()
+	resp, err := s.ListFiles(ctx, &pb.ListFilesRequest{Bucket: bucket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range resp.Files {
+		if f.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Функция для проверки результата действия: разрешённое действие проходит,
+// запрещённое отклоняется с кодом want
+func checkAllowed(t *testing.T, what string, err error, allow bool, want codes.Code) {
+	t.Helper()
+	if allow && err != nil {
+		t.Errorf("%s: %v", what, err)
+	}
+	if !allow && status.Code(err) != want {
+		t.Errorf("%s: %v, want %v", what, err, want)
+	}
+}
+
+func TestFileAccess(t *testing.T) {
+	s := newTestServer(t)
+	owner := asUser("alice")
+	acl := []*pb.ACLEntry{
+		{Principal: "user:bob", Permissions: []pb.Permission{pb.Permission_PERMISSION_READ}},
+		{Principal: "group:editors", Permissions: []pb.Permission{pb.Permission_PERMISSION_READ, pb.Permission_PERMISSION_WRITE}},
+		{Principal: "user:dave", Permissions: []pb.Permission{pb.Permission_PERMISSION_DELETE}},
+	}
+
+	// Права каждого пользователя проверяются на своём файле, так как
+	// удаление в конце проверки убирает файл
+	tests := []struct {
+		name                string
+		ctx                 context.Context
+		read, write, delete bool
+		manage              bool
+	}{
+		{name: "owner", ctx: owner, read: true, write: true, delete: true, manage: true},
+		{name: "admin", ctx: asUser("root", adminRole), read: true, write: true, delete: true, manage: true},
+		{name: "user grantee with read", ctx: asUser("bob"), read: true},
+		{name: "group grantee with read and write", ctx: asUser("eve", "editors"), read: true, write: true},
+		{name: "user grantee with delete", ctx: asUser("dave"), delete: true},
+		{name: "stranger", ctx: asUser("mallory", "viewers")},
+		// Без проверки подлинности разрешено всё
+		{name: "anonymous", ctx: context.Background(), read: true, write: true, delete: true, manage: true},
+	}
+	for _, tt := range tests {
+		id := createWithACL(t, s, owner, "", acl)
+
+		if got := listed(t, s, tt.ctx, "", id); got != tt.read {
+			t.Errorf("%s: file listed = %v, want %v", tt.name, got, tt.read)
+		}
+		_, err := s.ReadFile(tt.ctx, &pb.ReadFileRequest{Id: id})
+		checkAllowed(t, tt.name+": ReadFile", err, tt.read, codes.PermissionDenied)
+		_, err = s.GetACL(tt.ctx, &pb.GetACLRequest{Id: id})
+		checkAllowed(t, tt.name+": GetACL", err, tt.read, codes.PermissionDenied)
+		_, err = s.UpdateFile(tt.ctx, &pb.UpdateFileRequest{Id: id, File: []byte("updated by " + tt.name)})
+		checkAllowed(t, tt.name+": UpdateFile", err, tt.write, codes.PermissionDenied)
+		// Список доступа меняют только владелец и администраторы, даже
+		// если у пользователя есть все права на файл
+		_, err = s.SetACL(tt.ctx, &pb.SetACLRequest{Id: id, Entries: acl})
+		checkAllowed(t, tt.name+": SetACL", err, tt.manage, codes.PermissionDenied)
+		_, err = s.DeleteFile(tt.ctx, &pb.DeleteFileRequest{Id: id})
+		checkAllowed(t, tt.name+": DeleteFile", err, tt.delete, codes.PermissionDenied)
+
+		// Восстановление и окончательное удаление требуют права delete
+		if !tt.delete {
+			if _, err := s.DeleteFile(owner, &pb.DeleteFileRequest{Id: id}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err = s.UndeleteFile(tt.ctx, &pb.UndeleteFileRequest{Id: id})
+		checkAllowed(t, tt.name+": UndeleteFile", err, tt.delete, codes.PermissionDenied)
+		_, err = s.PurgeFile(tt.ctx, &pb.PurgeFileRequest{Id: id})
+		checkAllowed(t, tt.name+": PurgeFile", err, tt.delete, codes.PermissionDenied)
+	}
+}
+
+func TestReadOnlyGrantee(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	owner, reader := asUser("alice"), asUser("bob")
+	id := createWithACL(t, s, owner, "", []*pb.ACLEntry{
+		{Principal: "user:bob", Permissions: []pb.Permission{pb.Permission_PERMISSION_READ}},
+	})
+
+	if _, err := s.UpdateFile(owner, &pb.UpdateFileRequest{Id: id, File: []byte("second version")}); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := s.ListVersions(reader, &pb.ListVersionsRequest{Id: id})
+	if err != nil {
+		t.Fatalf("reader lists versions: %v", err)
+	}
+	if len(versions.Versions) < 2 {
+		t.Fatalf("%d versions after an update, want 2", len(versions.Versions))
+	}
+	// Откат к версии и блокировка для редактирования - тоже изменение файла
+	_, err = s.RestoreVersion(reader, &pb.RestoreVersionRequest{Id: id, Version: versions.Versions[0].Version})
+	checkAllowed(t, "RestoreVersion", err, false, codes.PermissionDenied)
+	_, err = s.AcquireLock(reader, &pb.AcquireLockRequest{Id: id})
+	checkAllowed(t, "AcquireLock", err, false, codes.PermissionDenied)
+	_, err = s.SetACL(reader, &pb.SetACLRequest{Id: id, Entries: []*pb.ACLEntry{
+		{Principal: "user:bob", Permissions: []pb.Permission{pb.Permission_PERMISSION_READ, pb.Permission_PERMISSION_WRITE}},
+	}})
+	checkAllowed(t, "SetACL granting itself write", err, false, codes.PermissionDenied)
+
+	// Отказы не изменили файл и его список доступа
+	got, err := s.ReadFile(ctx, &pb.ReadFileRequest{Id: id})
+	if err != nil || string(got.File) != "second version" {
+		t.Errorf("file after denied changes = %q, %v, want the second version", got.GetFile(), err)
+	}
+	acl, err := s.GetACL(ctx, &pb.GetACLRequest{Id: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acl.Owner != "alice" || len(acl.Entries) != 1 || len(acl.Entries[0].Permissions) != 1 {
+		t.Errorf("ACL after a denied SetACL = %v", acl)
+	}
+}
+
+func TestBucketAccessPrecedence(t *testing.T) {
+	s := newTestServer(t)
+	alice := asUser("alice")
+	_, err := s.CreateBucket(alice, &pb.CreateBucketRequest{Name: "team", Members: []string{"group:staff"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readers := []*pb.ACLEntry{
+		{Principal: "user:bob", Permissions: []pb.Permission{pb.Permission_PERMISSION_READ}},
+		{Principal: "user:carol", Permissions: []pb.Permission{pb.Permission_PERMISSION_READ}},
+	}
+	id := createWithACL(t, s, alice, "team", readers)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"bucket owner and file owner", alice, codes.OK},
+		{"member with file ACL", asUser("carol", "staff"), codes.OK},
+		// Права на файл не открывают чужой бакет: он неотличим от несуществующего
+		{"file ACL without membership", asUser("bob"), codes.NotFound},
+		// Участие в бакете не даёт прав на файлы других пользователей
+		{"member without file ACL", asUser("frank", "staff"), codes.PermissionDenied},
+		{"stranger", asUser("mallory"), codes.NotFound},
+		{"admin", asUser("root", adminRole), codes.OK},
+	}
+	for _, tt := range tests {
+		_, err := s.ReadFile(tt.ctx, &pb.ReadFileRequest{Bucket: "team", Id: id})
+		if status.Code(err) != tt.want {
+			t.Errorf("%s: ReadFile = %v, want %v", tt.name, err, tt.want)
+		}
+		_, err = s.ListFiles(tt.ctx, &pb.ListFilesRequest{Bucket: "team"})
+		if wantList := tt.want == codes.NotFound; (status.Code(err) == codes.NotFound) != wantList {
+			t.Errorf("%s: ListFiles = %v, want bucket hidden: %v", tt.name, err, wantList)
+		}
+	}
+
+	// Владелец бакета не получает прав на файлы, созданные в нём участниками
+	carol := asUser("carol", "staff")
+	own := createWithACL(t, s, carol, "team", nil)
+	_, err = s.ReadFile(alice, &pb.ReadFileRequest{Bucket: "team", Id: own})
+	checkAllowed(t, "bucket owner reads a member's file", err, false, codes.PermissionDenied)
+
+	// Исключённый из бакета участник теряет доступ к его файлам, хотя
+	// список доступа файла не менялся
+	if _, err := s.UpdateBucket(alice, &pb.UpdateBucketRequest{Name: "team"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.ReadFile(carol, &pb.ReadFileRequest{Bucket: "team", Id: id})
+	checkAllowed(t, "removed member reads a shared file", err, false, codes.NotFound)
+	buckets, err := s.ListBuckets(carol, &pb.ListBucketsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range buckets.Buckets {
+		if b.Name == "team" {
+			t.Error("removed member still lists the bucket")
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Настройки проверки подлинности из файла конфигурации
+type authConfig struct {
+	// Постоянные ключи доступа
+	APIKeys []apiKeyConfig `json:"api_keys"`
+	JWT     jwtConfig      `json:"jwt"`
+}
+
+// Ключ доступа и пользователь, которому он выдан
+type apiKeyConfig struct {
+	Key     string   `json:"key"`
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles"`
+}
+
+// Настройки проверки JWT. Токены HS256/384/512 проверяются общим секретом,
+// RS* и ES* - открытыми ключами из файла JWKS
+type jwtConfig struct {
+	HMACSecret string `json:"hmac_secret"`
+	JWKSFile   string `json:"jwks_file"`
+	// Если заданы, токен должен быть выпущен этим издателем для этого получателя
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+}
+
+// Пользователь, от имени которого выполняется запрос
+type identity struct {
+	Subject string
+	Roles   []string
+	// Способ проверки: "api_key" или "jwt"
+	Method string
+}
+
+// Ключ контекста, под которым хранится пользователь
+type identityKey struct{}
+
+// Функция для получения пользователя, выполняющего запрос
+func identityFromContext(ctx context.Context) (*identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*identity)
+	return id, ok
+}
+
+// Поля JWT, которые учитывает сервер
+type tokenClaims struct {
+	Roles []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// Проверка подлинности запросов по токену из метаданных gRPC
+type authenticator struct {
+	apiKeys []apiKeyConfig
+	parser  *jwt.Parser
+	keyfunc jwt.Keyfunc
+}
+
+// Функция для создания проверки подлинности по файлу конфигурации
+func newAuthenticator(path string) (*authenticator, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg authConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	a := &authenticator{apiKeys: cfg.APIKeys}
+	for _, k := range cfg.APIKeys {
+		if len(k.Key) == 0 || len(k.Subject) == 0 {
+			return nil, errors.New("API keys must have a key and a subject")
+		}
+	}
+
+	var methods []string
+	var keys *jwkSet
+	if len(cfg.JWT.HMACSecret) > 0 {
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+	if len(cfg.JWT.JWKSFile) > 0 {
+		keys, err = newJWKSet(cfg.JWT.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512")
+	}
+	if len(methods) == 0 {
+		return a, nil
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if len(cfg.JWT.Issuer) > 0 {
+		opts = append(opts, jwt.WithIssuer(cfg.JWT.Issuer))
+	}
+	if len(cfg.JWT.Audience) > 0 {
+		opts = append(opts, jwt.WithAudience(cfg.JWT.Audience))
+	}
+	a.parser = jwt.NewParser(opts...)
+	a.keyfunc = func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+			return []byte(cfg.JWT.HMACSecret), nil
+		}
+		return keys.key(t.Header["kid"])
+	}
+
+	return a, nil
+}
+
+// Метод для проверки токена из заголовка "authorization: Bearer <токен>"
+// и добавления пользователя в контекст запроса
+func (a *authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "Missing bearer token")
+	}
+	token := strings.TrimSpace(values[0])
+	if len(token) < 7 || !strings.EqualFold(token[:7], "bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "Authorization must be a bearer token")
+	}
+	token = strings.TrimSpace(token[7:])
+
+	id, err := a.identify(token)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid token: %v", err)
+	}
+	return context.WithValue(ctx, identityKey{}, id), nil
+}
+
+// Метод для определения пользователя по токену: JWT состоит из трёх частей,
+// разделённых точками, остальные токены считаются ключами доступа
+func (a *authenticator) identify(token string) (*identity, error) {
+	if strings.Count(token, ".") != 2 {
+		for _, k := range a.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(k.Key), []byte(token)) == 1 {
+				return &identity{Subject: k.Subject, Roles: k.Roles, Method: "api_key"}, nil
+			}
+		}
+		return nil, errors.New("unknown API key")
+	}
+
+	if a.parser == nil {
+		return nil, errors.New("JWT authentication is not configured")
+	}
+	var claims tokenClaims
+	if _, err := a.parser.ParseWithClaims(token, &claims, a.keyfunc); err != nil {
+		return nil, err
+	}
+	if len(claims.Subject) == 0 {
+		return nil, errors.New("token has no subject")
+	}
+	return &identity{Subject: claims.Subject, Roles: claims.Roles, Method: "jwt"}, nil
+}
+
+// Метод-перехватчик для проверки подлинности обычных вызовов
+func (a *authenticator) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// Метод-перехватчик для проверки подлинности потоковых вызовов
+func (a *authenticator) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// Поток, контекст которого содержит пользователя
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Метод для получения контекста потока
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// Функция для подключения проверки подлинности к серверу. Без файла
+// конфигурации запросы принимаются без проверки
+func authServerOptions(path string) ([]grpc.ServerOption, error) {
+	if len(path) == 0 {
+		log.Printf("Authentication is disabled: -auth-config is not set")
+		return nil, nil
+	}
+
+	a, err := newAuthenticator(path)
+	if err != nil {
+		return nil, err
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(a.unary),
+		grpc.ChainStreamInterceptor(a.stream),
+	}, nil
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+const (
+	testIssuer   = "https://auth.example.com"
+	testAudience = "go-file-storage"
+	testSecret   = "shared-secret"
+)
+
+// Функция для получения открытого ключа RSA в формате JWK
+func rsaJWK(kid string, key *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// Функция для получения открытого ключа ECDSA в формате JWK
+func ecJWK(kid string, key *ecdsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "EC",
+		Kid: kid,
+		Crv: key.Curve.Params().Name,
+		X:   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+	}
+}
+
+// Функция для записи значения в файл JSON
+func writeJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Функция для записи файла JWKS с ключами keys
+func writeJWKS(t *testing.T, path string, keys ...jsonWebKey) {
+	t.Helper()
+	writeJSON(t, path, map[string]interface{}{"keys": keys})
+}
+
+// Функция для создания проверки подлинности по настройкам cfg
+func newTestAuthenticator(t *testing.T, cfg authConfig) *authenticator {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "auth.json")
+	writeJSON(t, path, cfg)
+	a, err := newAuthenticator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// Функция для создания подписанного JWT. Пустой kid не попадает в заголовок
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if len(kid) > 0 {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// Функция для получения полей действующего токена с изменениями changes.
+// Поле со значением nil удаляется
+func testClaims(changes jwt.MapClaims) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub":   "alice",
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"admin"},
+	}
+	for k, v := range changes {
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+	}
+	return claims
+}
+
+// Функция для получения контекста входящего запроса с заголовком authorization
+func bearerContext(authorization string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", authorization))
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksPath, rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey))
+	a := newTestAuthenticator(t, authConfig{JWT: jwtConfig{
+		HMACSecret: testSecret,
+		JWKSFile:   jwksPath,
+		Issuer:     testIssuer,
+		Audience:   testAudience,
+	}})
+
+	// Без общего секрета токены HS* не принимаются вовсе
+	jwksOnly := newTestAuthenticator(t, authConfig{JWT: jwtConfig{JWKSFile: jwksPath}})
+
+	now := time.Now()
+	tests := []struct {
+		name  string
+		a     *authenticator
+		token string
+		ok    bool
+	}{
+		{"HS256", a, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(nil)), true},
+		{"HS512", a, signToken(t, jwt.SigningMethodHS512, []byte(testSecret), "", testClaims(nil)), true},
+		{"RS256", a, signToken(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", testClaims(nil)), true},
+		{"PS256", a, signToken(t, jwt.SigningMethodPS256, rsaKey, "rsa-1", testClaims(nil)), true},
+		{"ES256", a, signToken(t, jwt.SigningMethodES256, ecKey, "ec-1", testClaims(nil)), true},
+		{"JWKS only", jwksOnly, signToken(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", testClaims(nil)), true},
+
+		{"expired", a, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()})), false},
+		{"no expiration", a, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(jwt.MapClaims{"exp": nil})), false},
+		{"not valid yet", a, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(jwt.MapClaims{"nbf": now.Add(time.Hour).Unix()})), false},
+		{"wrong audience", a, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(jwt.MapClaims{"aud": "other-service"})), false},
+		{"no audience", a, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(jwt.MapClaims{"aud": nil})), false},
+		{"wrong issuer", a, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(jwt.MapClaims{"iss": "https://evil.example.com"})), false},
+		{"no subject", a, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(jwt.MapClaims{"sub": nil})), false},
+		{"wrong secret", a, signToken(t, jwt.SigningMethodHS256, []byte("guessed-secret"), "", testClaims(nil)), false},
+		{"wrong RSA key", a, signToken(t, jwt.SigningMethodRS256, otherRSAKey, "rsa-1", testClaims(nil)), false},
+		{"unknown kid", a, signToken(t, jwt.SigningMethodRS256, rsaKey, "rsa-2", testClaims(nil)), false},
+		{"no kid with several keys", a, signToken(t, jwt.SigningMethodRS256, rsaKey, "", testClaims(nil)), false},
+		{"alg none", a, signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", testClaims(nil)), false},
+		// Подмена алгоритма: токен HS256, подписанный открытым ключом RSA как секретом
+		{"HS256 with RSA public key", a, signToken(t, jwt.SigningMethodHS256, publicPEM, "rsa-1", testClaims(nil)), false},
+		{"HS256 without HMAC secret", jwksOnly, signToken(t, jwt.SigningMethodHS256, publicPEM, "rsa-1", testClaims(nil)), false},
+		{"ES256 with RSA kid", a, signToken(t, jwt.SigningMethodES256, ecKey, "rsa-1", testClaims(nil)), false},
+	}
+	for _, tt := range tests {
+		ctx, err := tt.a.authenticate(bearerContext("Bearer " + tt.token))
+		if !tt.ok {
+			if status.Code(err) != codes.Unauthenticated {
+				t.Errorf("%s: %v, want Unauthenticated", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		id, ok := identityFromContext(ctx)
+		if !ok || id.Subject != "alice" || id.Method != "jwt" || !id.hasRole(adminRole) {
+			t.Errorf("%s: identity %+v, want alice with the admin role", tt.name, id)
+		}
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	a := newTestAuthenticator(t, authConfig{APIKeys: []apiKeyConfig{
+		{Key: "secret-key-1", Subject: "bob", Roles: []string{"reader"}},
+		{Key: "secret-key-2", Subject: "carol"},
+	}})
+
+	tests := []struct {
+		authorization string
+		subject       string
+	}{
+		{"Bearer secret-key-1", "bob"},
+		{"bearer  secret-key-2 ", "carol"},
+		{"Bearer secret-key-3", ""},
+		{"Bearer secret-key", ""},
+		{"Bearer ", ""},
+		{"Basic secret-key-1", ""},
+		{"secret-key-1", ""},
+		// Без настроек JWT токен из трёх частей не принимается
+		{"Bearer " + signToken(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(nil)), ""},
+	}
+	for _, tt := range tests {
+		ctx, err := a.authenticate(bearerContext(tt.authorization))
+		if len(tt.subject) == 0 {
+			if status.Code(err) != codes.Unauthenticated {
+				t.Errorf("%q: %v, want Unauthenticated", tt.authorization, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.authorization, err)
+			continue
+		}
+		if id, _ := identityFromContext(ctx); id == nil || id.Subject != tt.subject || id.Method != "api_key" {
+			t.Errorf("%q: identity %+v, want %s", tt.authorization, id, tt.subject)
+		}
+	}
+
+	if id, _ := a.identify("secret-key-1"); id == nil || !id.hasRole("reader") {
+		t.Errorf("API key roles: %+v, want reader", id)
+	}
+	if _, err := a.authenticate(context.Background()); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("request without metadata: %v, want Unauthenticated", err)
+	}
+}
+
+func TestAuthConfigInvalid(t *testing.T) {
+	dir := t.TempDir()
+	badJWKS := filepath.Join(dir, "bad-jwks.json")
+	writeJWKS(t, badJWKS, jsonWebKey{Kty: "RSA", Kid: "rsa-1", N: "AQAB", E: "AQ"})
+	encOnly := filepath.Join(dir, "enc-jwks.json")
+	writeJWKS(t, encOnly, jsonWebKey{Kty: "RSA", Kid: "rsa-1", Use: "enc", N: "AQAB", E: "AQAB"})
+
+	tests := []struct {
+		name string
+		cfg  authConfig
+	}{
+		{"API key without subject", authConfig{APIKeys: []apiKeyConfig{{Key: "secret-key-1"}}}},
+		{"API key without key", authConfig{APIKeys: []apiKeyConfig{{Subject: "bob"}}}},
+		{"missing JWKS file", authConfig{JWT: jwtConfig{JWKSFile: filepath.Join(dir, "missing.json")}}},
+		{"invalid RSA exponent", authConfig{JWT: jwtConfig{JWKSFile: badJWKS}}},
+		{"no signing keys", authConfig{JWT: jwtConfig{JWKSFile: encOnly}}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, "auth.json")
+		writeJSON(t, path, tt.cfg)
+		if _, err := newAuthenticator(path); err == nil {
+			t.Errorf("%s: config accepted", tt.name)
+		}
+	}
+}
+
+// Функция для смены времени изменения файла: без этого перезапись файла
+// в пределах точности часов файловой системы может остаться незамеченной
+func touch(t *testing.T, path string, modTime time.Time) {
+	t.Helper()
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWKSRefresh(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksPath, rsaJWK("rsa-1", &oldKey.PublicKey))
+	touch(t, jwksPath, time.Now().Add(-time.Hour))
+
+	a := newTestAuthenticator(t, authConfig{JWT: jwtConfig{JWKSFile: jwksPath}})
+	oldToken := "Bearer " + signToken(t, jwt.SigningMethodRS256, oldKey, "rsa-1", testClaims(nil))
+	newToken := "Bearer " + signToken(t, jwt.SigningMethodRS256, newKey, "rsa-2", testClaims(nil))
+
+	if _, err := a.authenticate(bearerContext(oldToken)); err != nil {
+		t.Fatalf("token signed with the loaded key: %v", err)
+	}
+	if _, err := a.authenticate(bearerContext(newToken)); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("token signed with a key not yet in JWKS: %v, want Unauthenticated", err)
+	}
+
+	// Новый ключ доступен сразу после смены файла: токен с неизвестным kid
+	// вызывает проверку файла
+	writeJWKS(t, jwksPath, rsaJWK("rsa-2", &newKey.PublicKey))
+	touch(t, jwksPath, time.Now())
+	if _, err := a.authenticate(bearerContext(newToken)); err != nil {
+		t.Fatalf("token signed with the rotated key: %v", err)
+	}
+
+	// Удалённый из файла ключ перестаёт действовать при плановой проверке
+	set, err := newJWKSet(jwksPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.interval = 0
+	writeJWKS(t, jwksPath, rsaJWK("rsa-1", &oldKey.PublicKey))
+	touch(t, jwksPath, time.Now().Add(time.Minute))
+	if _, err := set.key("rsa-2"); err == nil {
+		t.Error("key removed from JWKS is still accepted")
+	}
+	if _, err := set.key("rsa-1"); err != nil {
+		t.Errorf("key added to JWKS: %v", err)
+	}
+
+	// Испорченный файл не отменяет прежние ключи
+	if err := ioutil.WriteFile(jwksPath, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, jwksPath, time.Now().Add(2*time.Minute))
+	if _, err := set.key("rsa-1"); err != nil {
+		t.Errorf("key after a broken JWKS update: %v", err)
+	}
+}
+
+// Поток, переданный перехватчику, с контекстом входящего запроса
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Метод для получения контекста потока
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestAuthInterceptors(t *testing.T) {
+	s := newTestServer(t)
+	a := newTestAuthenticator(t, authConfig{
+		APIKeys: []apiKeyConfig{{Key: "secret-key-1", Subject: "bob"}},
+		JWT:     jwtConfig{HMACSecret: testSecret},
+	})
+	aliceToken := "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(jwt.MapClaims{"roles": nil}))
+
+	create := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.CreateFile(ctx, req.(*pb.CreateFileRequest))
+	}
+	read := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.ReadFile(ctx, req.(*pb.ReadFileRequest))
+	}
+
+	resp, err := a.unary(bearerContext(aliceToken), &pb.CreateFileRequest{File: []byte("alice's file")}, nil, create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := resp.(*pb.CreateFileResponse).Id
+	md, err := s.meta.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Owner != "alice" {
+		t.Errorf("owner of a new file = %q, want alice", md.Owner)
+	}
+
+	if _, err := a.unary(bearerContext(aliceToken), &pb.ReadFileRequest{Id: id}, nil, read); err != nil {
+		t.Errorf("owner reads the file: %v", err)
+	}
+	if _, err := a.unary(bearerContext("Bearer secret-key-1"), &pb.ReadFileRequest{Id: id}, nil, read); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("another user reads the file: %v, want PermissionDenied", err)
+	}
+	if _, err := a.unary(context.Background(), &pb.ReadFileRequest{Id: id}, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Error("handler called without a token")
+		return nil, nil
+	}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("request without a token: %v, want Unauthenticated", err)
+	}
+
+	var subject string
+	err = a.stream(nil, &contextStream{ctx: bearerContext("Bearer secret-key-1")}, nil, func(srv interface{}, ss grpc.ServerStream) error {
+		if id, ok := identityFromContext(ss.Context()); ok {
+			subject = id.Subject
+		}
+		return nil
+	})
+	if err != nil || subject != "bob" {
+		t.Errorf("stream identity = %q, %v, want bob", subject, err)
+	}
+	err = a.stream(nil, &contextStream{ctx: bearerContext("Bearer secret-key-2")}, nil, func(srv interface{}, ss grpc.ServerStream) error {
+		t.Error("stream handler called with an unknown key")
+		return nil
+	})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("stream with an unknown key: %v, want Unauthenticated", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Ошибка, возвращаемая хранилищем, если объект не найден
+var ErrObjectNotFound = errors.New("object not found")
+
+// Информация об объекте хранилища
+type ObjectInfo struct {
+	Name       string
+	Size       int64
+	CreateTime time.Time
+	ModTime    time.Time
+}
+
+// Интерфейс хранилища файлов. Имена объектов могут содержать "/",
+// имена, начинающиеся с ".", зарезервированы для служебных данных
+type Backend interface {
+	// Сохраняет объект, заменяя существующий с тем же именем
+	Put(ctx context.Context, name string, r io.Reader) error
+	// Открывает объект для чтения целиком
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// Открывает для чтения length байт объекта начиная с offset;
+	// отрицательная длина означает чтение до конца объекта
+	GetRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error)
+	// Возвращает информацию об объекте
+	Stat(ctx context.Context, name string) (ObjectInfo, error)
+	// Возвращает список объектов, имена которых начинаются с prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Удаляет объект
+	Delete(ctx context.Context, name string) error
+}
+
+// Настройки хранилища, выбираемого при запуске
+type backendConfig struct {
+	Kind     string
+	Dir      string
+	BoltPath string
+	S3       s3Config
+}
+
+// Функция для создания хранилища по настройкам
+func newBackend(ctx context.Context, cfg backendConfig) (Backend, error) {
+	switch cfg.Kind {
+	case "disk":
+		return newDiskBackend(cfg.Dir)
+	case "memory":
+		return newMemoryBackend(), nil
+	case "bolt":
+		return newBoltBackend(cfg.BoltPath)
+	case "s3":
+		return newS3Backend(ctx, cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown backend %q", cfg.Kind)
+	}
+}
+
+// Функция для ошибки "объект не найден" с его именем
+func notFound(name string) error {
+	return fmt.Errorf("%w: %s", ErrObjectNotFound, name)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Хранилища, которые проверяются одним набором тестов
+func testBackends(t *testing.T) map[string]Backend {
+	disk, err := newDiskBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bolt, err := newBoltBackend(filepath.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bolt.db.Close() })
+	return map[string]Backend{
+		"memory": newMemoryBackend(),
+		"disk":   disk,
+		"bolt":   bolt,
+	}
+}
+
+// Функция для чтения объекта или его диапазона целиком
+func readObject(t *testing.T, b Backend, name string, offset, length int64) []byte {
+	t.Helper()
+	r, err := b.GetRange(context.Background(), name, offset, length)
+	if err != nil {
+		t.Fatalf("GetRange(%q, %d, %d): %v", name, offset, length, err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read %q: %v", name, err)
+	}
+	return data
+}
+
+func TestBackendRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for kind, b := range testBackends(t) {
+		t.Run(kind, func(t *testing.T) {
+			if err := b.Put(ctx, "a.txt", strings.NewReader("first")); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Put(ctx, "a.txt", strings.NewReader("0123456789")); err != nil {
+				t.Fatal(err)
+			}
+			if got := readObject(t, b, "a.txt", 0, -1); string(got) != "0123456789" {
+				t.Errorf("content after overwrite = %q", got)
+			}
+
+			info, err := b.Stat(ctx, "a.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Name != "a.txt" || info.Size != 10 {
+				t.Errorf("Stat = %+v, want name a.txt and size 10", info)
+			}
+
+			if err := b.Delete(ctx, "a.txt"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.Stat(ctx, "a.txt"); !errors.Is(err, ErrObjectNotFound) {
+				t.Errorf("Stat after delete: %v, want ErrObjectNotFound", err)
+			}
+		})
+	}
+}
+
+func TestBackendGetRange(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{0, 4, "0123"},
+		{3, 4, "3456"},
+		{7, -1, "789"},
+		{7, 100, "789"},
+		{10, -1, ""},
+		{12, 5, ""},
+		{4, 0, ""},
+	}
+	for kind, b := range testBackends(t) {
+		t.Run(kind, func(t *testing.T) {
+			if err := b.Put(ctx, "range.bin", strings.NewReader("0123456789")); err != nil {
+				t.Fatal(err)
+			}
+			for _, tt := range tests {
+				if got := readObject(t, b, "range.bin", tt.offset, tt.length); string(got) != tt.want {
+					t.Errorf("GetRange(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackendNotFound(t *testing.T) {
+	ctx := context.Background()
+	for kind, b := range testBackends(t) {
+		t.Run(kind, func(t *testing.T) {
+			if _, err := b.Get(ctx, "missing"); !errors.Is(err, ErrObjectNotFound) {
+				t.Errorf("Get: %v, want ErrObjectNotFound", err)
+			}
+			if _, err := b.GetRange(ctx, "missing", 1, 2); !errors.Is(err, ErrObjectNotFound) {
+				t.Errorf("GetRange: %v, want ErrObjectNotFound", err)
+			}
+			if _, err := b.Stat(ctx, "missing"); !errors.Is(err, ErrObjectNotFound) {
+				t.Errorf("Stat: %v, want ErrObjectNotFound", err)
+			}
+			if err := b.Delete(ctx, "missing"); !errors.Is(err, ErrObjectNotFound) {
+				t.Errorf("Delete: %v, want ErrObjectNotFound", err)
+			}
+		})
+	}
+}
+
+func TestBackendList(t *testing.T) {
+	ctx := context.Background()
+	names := []string{"a.txt", "b.txt", "chunks/aa", "chunks/ab", "chunks/b0"}
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"", names},
+		{"chunks/", []string{"chunks/aa", "chunks/ab", "chunks/b0"}},
+		{"chunks/a", []string{"chunks/aa", "chunks/ab"}},
+		{"b", []string{"b.txt"}},
+		{"zz", nil},
+	}
+	for kind, b := range testBackends(t) {
+		t.Run(kind, func(t *testing.T) {
+			for _, name := range names {
+				if err := b.Put(ctx, name, bytes.NewReader([]byte(name))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, tt := range tests {
+				objects, err := b.List(ctx, tt.prefix)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []string
+				for _, obj := range objects {
+					if obj.Size != int64(len(obj.Name)) {
+						t.Errorf("List(%q): %s has size %d", tt.prefix, obj.Name, obj.Size)
+					}
+					got = append(got, obj.Name)
+				}
+				sort.Strings(got)
+				if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+					t.Errorf("List(%q) = %v, want %v", tt.prefix, got, tt.want)
+				}
+			}
+		})
+	}
+}
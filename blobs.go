@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Имена бакетов базы со счётчиками ссылок на блобы и фрагменты
+var (
+	metadataBlobsBucket  = []byte("blobs")
+	metadataChunksBucket = []byte("chunks")
+)
+
+// Ссылка на фрагмент содержимого
+type chunkRef struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// Учёт блоба - содержимого, которое хранится один раз по его SHA-256.
+// На блоб ссылаются текущее содержимое файлов и их версии, а сам блоб
+// состоит из фрагментов, каждый из которых тоже хранится один раз
+type blobRecord struct {
+	Refs   int64      `json:"refs"`
+	Size   int64      `json:"size"`
+	Chunks []chunkRef `json:"chunks,omitempty"`
+}
+
+// Учёт фрагмента. На фрагмент ссылаются содержащие его блобы
+type chunkRecord struct {
+	Refs int64 `json:"refs"`
+	Size int64 `json:"size"`
+}
+
+// Содержимое файла: размер, контрольные суммы и MIME-тип
+type fileContent struct {
+	Size        int64
+	SHA256      string
+	CRC32C      string
+	ContentType string
+}
+
+// Имя блоба для сообщений об ошибках
+func blobObjectName(checksum string) string {
+	return "blobs/" + checksum
+}
+
+// Имя объекта фрагмента в хранилище
+func chunkObjectName(hash string) string {
+	return "chunks/" + hash
+}
+
+// Метод для получения содержимого, описанного сводкой
+func (c *contentSummary) content(ext string) fileContent {
+	return fileContent{Size: c.size, SHA256: c.Checksum(), CRC32C: c.CRC32C(), ContentType: c.ContentType(ext)}
+}
+
+// Функция для чтения записи учёта по ключу; возвращает false, если записи нет
+func getRecord(b *bolt.Bucket, key string, rec interface{}) (bool, error) {
+	raw := b.Get([]byte(key))
+	if raw == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, rec)
+}
+
+// Функция для сохранения записи учёта
+func putRecord(b *bolt.Bucket, key string, rec interface{}) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), raw)
+}
+
+// Метод для получения учёта блоба
+func (m *metadataStore) getBlob(checksum string) (*blobRecord, error) {
+	var rec blobRecord
+	var ok bool
+	err := m.db.View(func(tx *bolt.Tx) error {
+		var err error
+		ok, err = getRecord(tx.Bucket(metadataBlobsBucket), checksum, &rec)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, notFound(blobObjectName(checksum))
+	}
+	return &rec, nil
+}
+
+// Метод для взятия ссылки на блоб. Если блоба нет и chunks не nil,
+// он создаётся из этих фрагментов. Возвращает, был ли блоб создан
+func (m *metadataStore) retainBlob(checksum string, size int64, chunks []chunkRef) (bool, error) {
+	var created bool
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		blobs := tx.Bucket(metadataBlobsBucket)
+
+		var rec blobRecord
+		ok, err := getRecord(blobs, checksum, &rec)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if chunks == nil {
+				return notFound(blobObjectName(checksum))
+			}
+			rec = blobRecord{Size: size, Chunks: chunks}
+			created = true
+			if err := addTotals(tx, storageTotals{Blobs: 1}); err != nil {
+				return err
+			}
+		}
+		rec.Refs++
+		return putRecord(blobs, checksum, &rec)
+	})
+	return created, err
+}
+
+// Метод для освобождения ссылки на блоб. Если ссылок не осталось,
+// учёт блоба удаляется и возвращается, чтобы освободить его фрагменты
+func (m *metadataStore) releaseBlob(checksum string) (*blobRecord, error) {
+	var freed *blobRecord
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		blobs := tx.Bucket(metadataBlobsBucket)
+
+		var rec blobRecord
+		ok, err := getRecord(blobs, checksum, &rec)
+		if err != nil || !ok {
+			return err
+		}
+		rec.Refs--
+		if rec.Refs > 0 {
+			return putRecord(blobs, checksum, &rec)
+		}
+		freed = &rec
+		if err := addTotals(tx, storageTotals{Blobs: -1}); err != nil {
+			return err
+		}
+		return blobs.Delete([]byte(checksum))
+	})
+	return freed, err
+}
+
+// Метод для изменения числа ссылок на фрагмент на delta. Возвращает
+// новое число ссылок; учёт фрагмента без ссылок удаляется
+func (m *metadataStore) addChunkRefs(hash string, size, delta int64) (int64, error) {
+	var refs int64
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		chunks := tx.Bucket(metadataChunksBucket)
+
+		rec := chunkRecord{Size: size}
+		existed, err := getRecord(chunks, hash, &rec)
+		if err != nil {
+			return err
+		}
+		rec.Refs += delta
+		refs = rec.Refs
+		if rec.Refs <= 0 {
+			if !existed {
+				return nil
+			}
+			if err := addTotals(tx, storageTotals{Chunks: -1, StoredBytes: -rec.Size}); err != nil {
+				return err
+			}
+			return chunks.Delete([]byte(hash))
+		}
+		if !existed {
+			if err := addTotals(tx, storageTotals{Chunks: 1, StoredBytes: rec.Size}); err != nil {
+				return err
+			}
+		}
+		return putRecord(chunks, hash, &rec)
+	})
+	return refs, err
+}
+
+// Метод для получения учёта всех блобов
+func (m *metadataStore) listBlobs() (map[string]blobRecord, error) {
+	blobs := make(map[string]blobRecord)
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(metadataBlobsBucket).ForEach(func(k, raw []byte) error {
+			var rec blobRecord
+			if err := json.Unmarshal(raw, &rec); err != nil {
+				return err
+			}
+			blobs[string(k)] = rec
+			return nil
+		})
+	})
+	return blobs, err
+}
+
+// Метод для получения учёта всех фрагментов
+func (m *metadataStore) listChunks() (map[string]chunkRecord, error) {
+	chunks := make(map[string]chunkRecord)
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(metadataChunksBucket).ForEach(func(k, raw []byte) error {
+			var rec chunkRecord
+			if err := json.Unmarshal(raw, &rec); err != nil {
+				return err
+			}
+			chunks[string(k)] = rec
+			return nil
+		})
+	})
+	return chunks, err
+}
+
+// Метод для сохранения содержимого r в хранилище блобов. Содержимое
+// разбивается на фрагменты, и в хранилище записываются только те из них,
+// которых там ещё нет. На блоб берётся одна ссылка
+func (s *server) putBlob(ctx context.Context, r io.Reader) (*contentSummary, error) {
+	sum := newContentSummary()
+	chunks, err := s.storeChunks(ctx, io.TeeReader(r, sum))
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.meta.retainBlob(sum.Checksum(), sum.size, chunks)
+	if err != nil || !created {
+		// Такой блоб уже есть, и его фрагменты учтены в нём самом
+		s.releaseChunks(ctx, chunks)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return sum, nil
+}
+
+// Метод для записи фрагментов содержимого r. На каждый фрагмент берётся
+// ссылка; при ошибке взятые ссылки освобождаются
+func (s *server) storeChunks(ctx context.Context, r io.Reader) ([]chunkRef, error) {
+	chunks := []chunkRef{}
+	c := newChunker(r)
+	for {
+		data, err := c.Next()
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err == nil {
+			var ref chunkRef
+			ref, err = s.storeChunk(ctx, data)
+			if err == nil {
+				chunks = append(chunks, ref)
+				continue
+			}
+		}
+		s.releaseChunks(ctx, chunks)
+		return nil, err
+	}
+}
+
+// Метод для записи фрагмента, если его ещё нет в хранилище. Ссылка
+// учитывается до записи: при сбое фрагмент останется лишним, но не пропадёт.
+// Повреждённый или пропавший из хранилища фрагмент перезаписывается заново
+// полученным содержимым
+func (s *server) storeChunk(ctx context.Context, data []byte) (chunkRef, error) {
+	hash := sha256.Sum256(data)
+	ref := chunkRef{Hash: hex.EncodeToString(hash[:]), Size: int64(len(data))}
+
+	name := chunkObjectName(ref.Hash)
+	unlock := s.locks.Lock(name)
+	defer unlock()
+
+	refs, err := s.meta.addChunkRefs(ref.Hash, ref.Size, 1)
+	if err != nil {
+		return ref, err
+	}
+	repair, missing := false, false
+	if refs > 1 {
+		repair, err = s.meta.hasCorrupted([]chunkRef{ref})
+		if err == nil && !repair {
+			_, err = s.backend.Stat(ctx, name)
+			if errors.Is(err, ErrObjectNotFound) {
+				missing, err = true, nil
+			}
+		}
+		if err != nil {
+			s.meta.addChunkRefs(ref.Hash, ref.Size, -1)
+			return ref, err
+		}
+		if !repair && !missing {
+			return ref, nil
+		}
+	}
+
+	if err := s.backend.Put(ctx, name, bytes.NewReader(data)); err != nil {
+		s.meta.addChunkRefs(ref.Hash, ref.Size, -1)
+		return ref, err
+	}
+	if repair {
+		s.forgetCorrupted(ctx, ref.Hash)
+		log.Printf("Chunk %s has been repaired", ref.Hash)
+	}
+	if missing {
+		log.Printf("Chunk %s was missing from storage and has been restored", ref.Hash)
+	}
+	return ref, nil
+}
+
+// Метод для освобождения ссылок на фрагменты. Фрагменты без ссылок удаляются
+func (s *server) releaseChunks(ctx context.Context, chunks []chunkRef) {
+	for _, ref := range chunks {
+		name := chunkObjectName(ref.Hash)
+		unlock := s.locks.Lock(name)
+
+		refs, err := s.meta.addChunkRefs(ref.Hash, ref.Size, -1)
+		if err != nil {
+			log.Printf("Failed to release chunk %s: %v", ref.Hash, err)
+		} else if refs <= 0 {
+			if err := s.backend.Delete(ctx, name); err != nil && !errors.Is(err, ErrObjectNotFound) {
+				log.Printf("Failed to delete chunk %s: %v", ref.Hash, err)
+			}
+			s.forgetCorrupted(ctx, ref.Hash)
+		}
+
+		unlock()
+	}
+}
+
+// Метод для взятия ещё одной ссылки на уже хранящийся блоб
+func (s *server) retainBlob(ctx context.Context, checksum string) error {
+	_, err := s.meta.retainBlob(checksum, 0, nil)
+	return err
+}
+
+// Метод для освобождения ссылки на блоб. Фрагменты блоба без ссылок
+// освобождаются
+func (s *server) releaseBlob(ctx context.Context, checksum string) {
+	rec, err := s.meta.releaseBlob(checksum)
+	if err != nil {
+		log.Printf("Failed to release blob %s: %v", checksum, err)
+		return
+	}
+	if rec != nil {
+		s.releaseChunks(ctx, rec.Chunks)
+	}
+}
+
+// Метод для освобождения ссылок файла: на текущее содержимое и на все версии
+func (s *server) releaseFileBlobs(ctx context.Context, md *fileMetadata) {
+	s.releaseBlob(ctx, md.SHA256)
+	for _, v := range md.Versions {
+		s.releaseBlob(ctx, v.SHA256)
+	}
+}
+
+// Метод для чтения length байт блоба начиная с offset; отрицательная
+// длина означает чтение до конца. Блоб с повреждёнными фрагментами не читается
+func (s *server) openBlob(ctx context.Context, checksum string, offset, length int64) (io.ReadCloser, error) {
+	rec, err := s.meta.getBlob(checksum)
+	if err != nil {
+		return nil, err
+	}
+	corrupted, err := s.meta.hasCorrupted(rec.Chunks)
+	if err != nil {
+		return nil, err
+	}
+	if corrupted {
+		return nil, fmt.Errorf("%w: %s", errContentCorrupted, checksum)
+	}
+	return newChunkReader(ctx, s.backend, rec.Chunks, offset, length), nil
+}
+
+// Метод для получения статистики хранилища и экономии от дедупликации.
+// Статистика берётся из сводных счётчиков каталога
+func (s *server) GetStorageStats(ctx context.Context, req *pb.GetStorageStatsRequest) (*pb.GetStorageStatsResponse, error) {
+	if err := checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	t, err := s.meta.totals()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to read storage statistics: %v", err)
+	}
+
+	return &pb.GetStorageStatsResponse{
+		Files:        t.Files,
+		DeletedFiles: t.DeletedFiles,
+		Versions:     t.Versions,
+		Blobs:        t.Blobs,
+		Chunks:       t.Chunks,
+		LogicalBytes: t.LogicalBytes,
+		StoredBytes:  t.StoredBytes,
+		SavedBytes:   t.LogicalBytes - t.StoredBytes,
+	}, nil
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Функция для создания сервера с хранилищем в памяти и временным каталогом
+func newTestServer(t *testing.T) *server {
+	meta, err := newMetadataStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { meta.db.Close() })
+	return &server{backend: newMemoryBackend(), meta: meta, locks: newLockManager(), quotas: &quotaConfig{}}
+}
+
+// Функция для получения случайного содержимого размером size
+func randomContent(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// Функция для получения SHA-256 содержимого в шестнадцатеричном виде
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Функция для получения хешей фрагментов содержимого
+func chunkHashes(t *testing.T, data []byte) []string {
+	t.Helper()
+	var hashes []string
+	c := newChunker(bytes.NewReader(data))
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return hashes
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, sha256Hex(chunk))
+	}
+}
+
+// Ожидаемое состояние учёта: ссылки на блобы и фрагменты по их хешам
+type refState struct {
+	blobs  map[string]int64
+	chunks map[string]int64
+}
+
+// Функция для проверки, что учёт блобов и фрагментов и объекты фрагментов
+// в хранилище совпадают с ожидаемыми
+func checkRefs(t *testing.T, s *server, step string, want refState) {
+	t.Helper()
+	blobs, err := s.meta.listBlobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != len(want.blobs) {
+		t.Errorf("%s: %d blobs, want %d", step, len(blobs), len(want.blobs))
+	}
+	for checksum, refs := range want.blobs {
+		if got := blobs[checksum].Refs; got != refs {
+			t.Errorf("%s: blob %.8s has %d refs, want %d", step, checksum, got, refs)
+		}
+	}
+
+	chunks, err := s.meta.listChunks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != len(want.chunks) {
+		t.Errorf("%s: %d chunks, want %d", step, len(chunks), len(want.chunks))
+	}
+	for hash, refs := range want.chunks {
+		if got := chunks[hash].Refs; got != refs {
+			t.Errorf("%s: chunk %.8s has %d refs, want %d", step, hash, got, refs)
+		}
+	}
+
+	objects, err := s.backend.List(context.Background(), "chunks/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != len(want.chunks) {
+		t.Errorf("%s: %d chunk objects in storage, want %d", step, len(objects), len(want.chunks))
+	}
+
+	checkStats(t, s, step)
+}
+
+// Функция для проверки, что сводные счётчики хранилища совпадают
+// со статистикой, подсчитанной по всему каталогу
+func checkStats(t *testing.T, s *server, step string) {
+	t.Helper()
+	files, err := s.meta.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := s.meta.listBlobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := s.meta.listChunks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &pb.GetStorageStatsResponse{Blobs: int64(len(blobs)), Chunks: int64(len(chunks))}
+	for _, md := range files {
+		if md.deleted() {
+			want.DeletedFiles++
+		} else {
+			want.Files++
+		}
+		want.Versions += int64(len(md.Versions))
+		want.LogicalBytes += md.logicalSize()
+	}
+	for _, rec := range chunks {
+		want.StoredBytes += rec.Size
+	}
+	want.SavedBytes = want.LogicalBytes - want.StoredBytes
+
+	got, err := s.GetStorageStats(context.Background(), &pb.GetStorageStatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("%s: storage stats = %v, want %v", step, got, want)
+	}
+}
+
+// Функция для подсчёта ссылок блобов на фрагменты
+func chunkRefs(blobs ...[]string) map[string]int64 {
+	refs := make(map[string]int64)
+	for _, hashes := range blobs {
+		for _, h := range hashes {
+			refs[h]++
+		}
+	}
+	return refs
+}
+
+func TestBlobRefsAcrossFileLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+
+	// Два блоба отличаются только концом, поэтому делят первые фрагменты
+	x := randomContent(1, 3<<20)
+	y := append(append([]byte{}, x[:len(x)-100]...), randomContent(2, 100)...)
+	xChunks, yChunks := chunkHashes(t, x), chunkHashes(t, y)
+	if len(xChunks) < 2 || xChunks[0] != yChunks[0] {
+		t.Fatalf("test content must share its first chunk, got %d chunks", len(xChunks))
+	}
+
+	a, err := s.CreateFile(ctx, &pb.CreateFileRequest{File: x, Extension: ".bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.CreateFile(ctx, &pb.CreateFileRequest{File: x, Extension: ".bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRefs(t, s, "two files with the same content", refState{
+		blobs:  map[string]int64{sha256Hex(x): 2},
+		chunks: chunkRefs(xChunks),
+	})
+
+	if _, err := s.UpdateFile(ctx, &pb.UpdateFileRequest{Id: a.Id, File: y}); err != nil {
+		t.Fatal(err)
+	}
+	both := refState{
+		blobs:  map[string]int64{sha256Hex(x): 2, sha256Hex(y): 1},
+		chunks: chunkRefs(xChunks, yChunks),
+	}
+	checkRefs(t, s, "update keeps the previous version", both)
+
+	if _, err := s.DeleteFile(ctx, &pb.DeleteFileRequest{Id: a.Id}); err != nil {
+		t.Fatal(err)
+	}
+	checkRefs(t, s, "file in trash", both)
+
+	if _, err := s.PurgeFile(ctx, &pb.PurgeFileRequest{Id: a.Id}); err != nil {
+		t.Fatal(err)
+	}
+	checkRefs(t, s, "purge releases the file and its version", refState{
+		blobs:  map[string]int64{sha256Hex(x): 1},
+		chunks: chunkRefs(xChunks),
+	})
+
+	if _, err := s.PurgeFile(ctx, &pb.PurgeFileRequest{Id: b.Id}); err != nil {
+		t.Fatal(err)
+	}
+	checkRefs(t, s, "last file purged", refState{})
+
+	byOwner, byBucket, err := s.meta.usage("", defaultBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byOwner != (usage{}) || byBucket != (usage{}) {
+		t.Errorf("usage after purge = %+v, %+v, want zero", byOwner, byBucket)
+	}
+}
+
+func TestBlobRefsRestoreVersion(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	x, y := randomContent(3, 1000), randomContent(4, 1000)
+
+	f, err := s.CreateFile(ctx, &pb.CreateFileRequest{File: x})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateFile(ctx, &pb.UpdateFileRequest{Id: f.Id, File: y}); err != nil {
+		t.Fatal(err)
+	}
+	// Версия 1 становится текущей, а версия 2 сохраняется: на x ссылаются
+	// версия 1 и текущее содержимое
+	if _, err := s.RestoreVersion(ctx, &pb.RestoreVersionRequest{Id: f.Id, Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	checkRefs(t, s, "restored version", refState{
+		blobs:  map[string]int64{sha256Hex(x): 2, sha256Hex(y): 1},
+		chunks: chunkRefs([]string{sha256Hex(x)}, []string{sha256Hex(y)}),
+	})
+
+	if _, err := s.PurgeFile(ctx, &pb.PurgeFileRequest{Id: f.Id}); err != nil {
+		t.Fatal(err)
+	}
+	checkRefs(t, s, "purged", refState{})
+}
+
+func TestBlobRefsWithoutVersioning(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	x, y := randomContent(5, 1000), randomContent(6, 1000)
+
+	_, err := s.CreateBucket(ctx, &pb.CreateBucketRequest{
+		Name:     "latest",
+		Settings: &pb.BucketSettings{Versioning: pb.Versioning_VERSIONING_DISABLED},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := s.CreateFile(ctx, &pb.CreateFileRequest{Bucket: "latest", File: x})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateFile(ctx, &pb.UpdateFileRequest{Bucket: "latest", Id: f.Id, File: y}); err != nil {
+		t.Fatal(err)
+	}
+	checkRefs(t, s, "update without versioning releases the old content", refState{
+		blobs:  map[string]int64{sha256Hex(y): 1},
+		chunks: chunkRefs([]string{sha256Hex(y)}),
+	})
+}
+
+func TestBlobRefsChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	x := randomContent(7, 1000)
+
+	_, err := s.CreateFile(ctx, &pb.CreateFileRequest{File: x, Sha256: sha256Hex([]byte("other"))})
+	if status.Code(err) != codes.DataLoss {
+		t.Fatalf("CreateFile with a wrong checksum: %v, want DataLoss", err)
+	}
+	checkRefs(t, s, "rejected content", refState{})
+
+	// Содержимое другого файла при отклонённой записи не освобождается
+	f, err := s.CreateFile(ctx, &pb.CreateFileRequest{File: x})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.UpdateFile(ctx, &pb.UpdateFileRequest{Id: f.Id, File: x, Sha256: sha256Hex([]byte("other"))})
+	if status.Code(err) != codes.DataLoss {
+		t.Fatalf("UpdateFile with a wrong checksum: %v, want DataLoss", err)
+	}
+	checkRefs(t, s, "rejected update of the same content", refState{
+		blobs:  map[string]int64{sha256Hex(x): 1},
+		chunks: chunkRefs([]string{sha256Hex(x)}),
+	})
+
+	r, err := s.openBlob(ctx, sha256Hex(x), 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, x) {
+		t.Errorf("content after rejected update: %d bytes, %v", len(data), err)
+	}
+	if _, err := s.openBlob(ctx, sha256Hex([]byte("other")), 0, -1); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("openBlob of unknown content: %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestBlobRefsMissingChunkRestored(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	x := randomContent(8, 1000)
+
+	if _, err := s.CreateFile(ctx, &pb.CreateFileRequest{File: x}); err != nil {
+		t.Fatal(err)
+	}
+	// Хранилище потеряло фрагменты, а каталог их ещё учитывает
+	s.backend = newMemoryBackend()
+
+	f, err := s.CreateFile(ctx, &pb.CreateFileRequest{File: x})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.ReadFile(ctx, &pb.ReadFileRequest{Id: f.Id})
+	if err != nil {
+		t.Fatalf("ReadFile after the chunk was lost: %v", err)
+	}
+	if !bytes.Equal(resp.File, x) {
+		t.Errorf("ReadFile returned %d bytes, want the %d written", len(resp.File), len(x))
+	}
+}
+
+func TestStorageTotalsRebuilt(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	x := randomContent(9, 2<<20)
+
+	f, err := s.CreateFile(ctx, &pb.CreateFileRequest{File: x})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateFile(ctx, &pb.UpdateFileRequest{Id: f.Id, File: x[:1<<20]}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateFile(ctx, &pb.CreateFileRequest{File: x[1<<20:]}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DeleteFile(ctx, &pb.DeleteFileRequest{Id: f.Id}); err != nil {
+		t.Fatal(err)
+	}
+	checkStats(t, s, "before rebuilding")
+
+	// Каталог без сводных счётчиков заполняет их заново при открытии
+	path := s.meta.db.Path()
+	err = s.meta.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metadataUsageBucket).Delete([]byte(storageTotalsKey))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.meta.db.Close()
+	if s.meta, err = newMetadataStore(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.meta.db.Close() })
+	checkStats(t, s, "after rebuilding")
+}
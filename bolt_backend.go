@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Имена бакетов базы: содержимое объектов и информация о них
+var (
+	boltObjectsBucket = []byte("objects")
+	boltInfoBucket    = []byte("info")
+)
+
+// Хранилище файлов в одном файле встроенной базы bbolt. Предназначено для
+// большого числа небольших файлов: объект целиком читается в память
+type boltBackend struct {
+	db *bolt.DB
+}
+
+// Информация об объекте, хранимая в базе
+type boltObjectInfo struct {
+	Size       int64     `json:"size"`
+	CreateTime time.Time `json:"create_time"`
+	ModTime    time.Time `json:"mod_time"`
+}
+
+// Функция для открытия базы по пути path
+func newBoltBackend(path string) (*boltBackend, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltObjectsBucket, boltInfoBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltBackend{db: db}, nil
+}
+
+// Метод для сохранения объекта
+func (b *boltBackend) Put(ctx context.Context, name string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		infos := tx.Bucket(boltInfoBucket)
+
+		now := time.Now()
+		info := boltObjectInfo{Size: int64(len(data)), CreateTime: now, ModTime: now}
+		var old boltObjectInfo
+		if raw := infos.Get([]byte(name)); raw != nil && json.Unmarshal(raw, &old) == nil {
+			info.CreateTime = old.CreateTime
+		}
+
+		raw, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		if err := infos.Put([]byte(name), raw); err != nil {
+			return err
+		}
+		return tx.Bucket(boltObjectsBucket).Put([]byte(name), data)
+	})
+}
+
+// Метод для открытия объекта
+func (b *boltBackend) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.GetRange(ctx, name, 0, -1)
+}
+
+// Метод для открытия диапазона байт объекта. Данные копируются,
+// так как вне транзакции память базы использовать нельзя
+func (b *boltBackend) GetRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	var data []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltObjectsBucket).Get([]byte(name))
+		if value == nil {
+			return notFound(name)
+		}
+
+		size := int64(len(value))
+		if offset > size {
+			offset = size
+		}
+		if length < 0 || offset+length > size {
+			length = size - offset
+		}
+		data = append([]byte(nil), value[offset:offset+length]...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Метод для получения информации об объекте
+func (b *boltBackend) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	var info ObjectInfo
+	err := b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltInfoBucket).Get([]byte(name))
+		if raw == nil {
+			return notFound(name)
+		}
+
+		var err error
+		info, err = decodeBoltInfo(name, raw)
+		return err
+	})
+
+	return info, err
+}
+
+// Метод для получения списка объектов
+func (b *boltBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltInfoBucket).Cursor()
+		for k, raw := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, raw = c.Next() {
+			info, err := decodeBoltInfo(string(k), raw)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// Метод для удаления объекта
+func (b *boltBackend) Delete(ctx context.Context, name string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		infos := tx.Bucket(boltInfoBucket)
+		if infos.Get([]byte(name)) == nil {
+			return notFound(name)
+		}
+		if err := infos.Delete([]byte(name)); err != nil {
+			return err
+		}
+		return tx.Bucket(boltObjectsBucket).Delete([]byte(name))
+	})
+}
+
+// Функция для разбора информации об объекте из базы
+func decodeBoltInfo(name string, raw []byte) (ObjectInfo, error) {
+	var info boltObjectInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{
+		Name:       name,
+		Size:       info.Size,
+		CreateTime: info.CreateTime,
+		ModTime:    info.ModTime,
+	}, nil
+}
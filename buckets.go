@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Имя бакета базы со списком бакетов файлов
+var metadataBucketsBucket = []byte("buckets")
+
+// Бакет, в котором хранятся файлы, если бакет в запросе не указан,
+// а также все файлы, записанные до появления бакетов
+const defaultBucket = "default"
+
+// Ошибки каталога при работе с бакетами
+var (
+	errBucketNotFound = errors.New("bucket not found")
+	errBucketExists   = errors.New("bucket already exists")
+	errBucketNotEmpty = errors.New("bucket is not empty")
+)
+
+// Настройки бакета
+type bucketSettings struct {
+	// Расширение файлов, созданных без указания расширения
+	DefaultExtension string `json:"default_extension,omitempty"`
+	// Наибольший размер файла в байтах; 0 - без ограничения
+	MaxFileSize int64 `json:"max_file_size,omitempty"`
+	// Не сохранять прежнее содержимое файлов как версии
+	DisableVersioning bool `json:"disable_versioning,omitempty"`
+	// Квота на объём и число файлов бакета
+	Quota quota `json:"quota"`
+}
+
+// Бакет - пространство имён файлов
+type bucketRecord struct {
+	Name       string         `json:"name"`
+	Owner      string         `json:"owner,omitempty"`
+	CreateTime time.Time      `json:"create_time"`
+	Settings   bucketSettings `json:"settings"`
+	// Пользователи ("user:<имя>") и группы ("group:<роль>"), которым
+	// кроме владельца доступен бакет
+	Members []string `json:"members,omitempty"`
+}
+
+// Функция для создания бакета по умолчанию, если его ещё нет
+func ensureDefaultBucket(tx *bolt.Tx) error {
+	buckets := tx.Bucket(metadataBucketsBucket)
+	if buckets.Get([]byte(defaultBucket)) != nil {
+		return nil
+	}
+	return putRecord(buckets, defaultBucket, &bucketRecord{Name: defaultBucket, CreateTime: time.Now()})
+}
+
+// Метод для получения бакета по имени
+func (m *metadataStore) getBucket(name string) (*bucketRecord, error) {
+	var b bucketRecord
+	err := m.db.View(func(tx *bolt.Tx) error {
+		ok, err := getRecord(tx.Bucket(metadataBucketsBucket), name, &b)
+		if err == nil && !ok {
+			err = errBucketNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Метод для создания бакета
+func (m *metadataStore) createBucket(b *bucketRecord) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		buckets := tx.Bucket(metadataBucketsBucket)
+		if buckets.Get([]byte(b.Name)) != nil {
+			return errBucketExists
+		}
+		return putRecord(buckets, b.Name, b)
+	})
+}
+
+// Метод для изменения бакета в одной транзакции
+func (m *metadataStore) updateBucket(name string, fn func(b *bucketRecord)) (*bucketRecord, error) {
+	var b bucketRecord
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		buckets := tx.Bucket(metadataBucketsBucket)
+		ok, err := getRecord(buckets, name, &b)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errBucketNotFound
+		}
+		fn(&b)
+		return putRecord(buckets, name, &b)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Метод для удаления бакета, если в нём нет файлов, в том числе в корзине.
+// Файлы бакета учтены в его счётчике занятого места
+func (m *metadataStore) deleteBucket(name string) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		_, used, err := getUsage(tx, "", name)
+		if err != nil {
+			return err
+		}
+		if used.Objects > 0 {
+			return errBucketNotEmpty
+		}
+
+		buckets := tx.Bucket(metadataBucketsBucket)
+		if buckets.Get([]byte(name)) == nil {
+			return errBucketNotFound
+		}
+		return buckets.Delete([]byte(name))
+	})
+}
+
+// Метод для получения всех бакетов в порядке имён
+func (m *metadataStore) listBuckets() ([]*bucketRecord, error) {
+	var buckets []*bucketRecord
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(metadataBucketsBucket).ForEach(func(k, raw []byte) error {
+			b := &bucketRecord{}
+			if err := json.Unmarshal(raw, b); err != nil {
+				return err
+			}
+			buckets = append(buckets, b)
+			return nil
+		})
+	})
+	return buckets, err
+}
+
+// Бакет файла. Файлы, записанные до появления бакетов, лежат в бакете
+// по умолчанию
+func (md *fileMetadata) bucket() string {
+	if len(md.Bucket) == 0 {
+		return defaultBucket
+	}
+	return md.Bucket
+}
+
+// Функция для получения ключа блокировки бакета. Он не совпадает
+// с идентификаторами файлов, так как содержит "/"
+func bucketLockKey(name string) string {
+	return "bucket/" + name
+}
+
+// Функция для проверки имени бакета: от 3 до 63 строчных латинских
+// букв, цифр и дефисов, без дефиса в начале и в конце
+func validBucketName(name string) bool {
+	if len(name) < 3 || len(name) > 63 || name[0] == '-' || name[len(name)-1] == '-' {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// Метод для проверки, может ли пользователь работать с бакетом.
+// Бакеты без владельца доступны всем
+func (b *bucketRecord) allows(caller *identity) bool {
+	if caller.hasRole(adminRole) || len(b.Owner) == 0 || b.Owner == caller.Subject {
+		return true
+	}
+	for _, p := range b.Members {
+		if caller.matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Метод для получения расширения нового файла: если оно не указано,
+// берётся расширение бакета по умолчанию
+func (b *bucketRecord) extension(ext string) string {
+	if len(ext) == 0 {
+		ext = b.Settings.DefaultExtension
+	}
+	return normalizeExtension(ext)
+}
+
+// Метод для проверки, что файл размером size помещается в бакет
+func (b *bucketRecord) checkSize(size int64) error {
+	if b.Settings.MaxFileSize > 0 && size > b.Settings.MaxFileSize {
+		return status.Errorf(codes.InvalidArgument, "File size %d exceeds the limit of %d bytes in bucket %s", size, b.Settings.MaxFileSize, b.Name)
+	}
+	return nil
+}
+
+// Метод для получения версии, в которую переходит текущее содержимое
+// файла при его замене. Если бакет не хранит версии, возвращается nil:
+// прежнее содержимое освобождается после записи нового
+func (b *bucketRecord) archive(md *fileMetadata) *fileVersion {
+	if b.Settings.DisableVersioning {
+		return nil
+	}
+	return md.archive()
+}
+
+// Метод для преобразования бакета в сообщение gRPC
+func (b *bucketRecord) proto() *pb.Bucket {
+	versioning := pb.Versioning_VERSIONING_ENABLED
+	if b.Settings.DisableVersioning {
+		versioning = pb.Versioning_VERSIONING_DISABLED
+	}
+	return &pb.Bucket{
+		Name:       b.Name,
+		Owner:      b.Owner,
+		CreateTime: timestamppb.New(b.CreateTime),
+		Settings: &pb.BucketSettings{
+			DefaultExtension: b.Settings.DefaultExtension,
+			MaxFileSize:      b.Settings.MaxFileSize,
+			Versioning:       versioning,
+			Quota:            b.Settings.Quota.proto(),
+		},
+		Members: b.Members,
+	}
+}
+
+// Функция для разбора настроек бакета из запроса
+func parseBucketSettings(settings *pb.BucketSettings) (bucketSettings, error) {
+	var cfg bucketSettings
+	if settings == nil {
+		return cfg, nil
+	}
+	if settings.MaxFileSize < 0 {
+		return cfg, status.Errorf(codes.InvalidArgument, "Invalid max file size: %d", settings.MaxFileSize)
+	}
+	if len(settings.DefaultExtension) > 0 {
+		ext := normalizeExtension(settings.DefaultExtension)
+		if _, err := objectName("id", ext); err != nil {
+			return cfg, status.Errorf(codes.InvalidArgument, "Invalid default extension: %q", settings.DefaultExtension)
+		}
+		cfg.DefaultExtension = ext
+	}
+	limits, err := parseQuota(settings.Quota)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MaxFileSize = settings.MaxFileSize
+	cfg.DisableVersioning = settings.Versioning == pb.Versioning_VERSIONING_DISABLED
+	cfg.Quota = limits
+	return cfg, nil
+}
+
+// Функция для проверки списка участников бакета
+func parseMembers(members []string) ([]string, error) {
+	for _, p := range members {
+		if err := checkPrincipal(p); err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
+
+// Метод для получения бакета, которым может пользоваться выполняющий
+// запрос. Пустое имя означает бакет по умолчанию. Недоступный бакет
+// неотличим от несуществующего
+func (s *server) lookupBucket(ctx context.Context, name string) (*bucketRecord, error) {
+	if len(name) == 0 {
+		name = defaultBucket
+	}
+	if !validBucketName(name) {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid bucket name: %q", name)
+	}
+
+	b, err := s.meta.getBucket(name)
+	if errors.Is(err, errBucketNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Bucket not found: %s", name)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to read bucket: %v", err)
+	}
+	if caller, ok := identityFromContext(ctx); ok && !b.allows(caller) {
+		return nil, status.Errorf(codes.NotFound, "Bucket not found: %s", name)
+	}
+	return b, nil
+}
+
+// Функция для проверки, может ли выполняющий запрос изменять или
+// удалять бакет: это разрешено только владельцу и администраторам
+func checkBucketManager(ctx context.Context, b *bucketRecord) error {
+	caller, ok := identityFromContext(ctx)
+	if !ok || caller.hasRole(adminRole) || (len(b.Owner) > 0 && b.Owner == caller.Subject) {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "Only the owner of bucket %s may change it", b.Name)
+}
+
+// Метод для создания бакета. Его владельцем становится выполняющий запрос
+func (s *server) CreateBucket(ctx context.Context, req *pb.CreateBucketRequest) (*pb.CreateBucketResponse, error) {
+	if !validBucketName(req.Name) {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid bucket name: %q", req.Name)
+	}
+	settings, err := parseBucketSettings(req.Settings)
+	if err != nil {
+		return nil, err
+	}
+	members, err := parseMembers(req.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bucketRecord{Name: req.Name, CreateTime: time.Now(), Settings: settings, Members: members}
+	if caller, ok := identityFromContext(ctx); ok {
+		b.Owner = caller.Subject
+	}
+	err = s.meta.createBucket(b)
+	if errors.Is(err, errBucketExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "Bucket already exists: %s", req.Name)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create bucket: %v", err)
+	}
+
+	return &pb.CreateBucketResponse{Bucket: b.proto()}, nil
+}
+
+// Метод для получения списка доступных бакетов
+func (s *server) ListBuckets(ctx context.Context, req *pb.ListBucketsRequest) (*pb.ListBucketsResponse, error) {
+	buckets, err := s.meta.listBuckets()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to list buckets: %v", err)
+	}
+
+	caller, authenticated := identityFromContext(ctx)
+	resp := &pb.ListBucketsResponse{}
+	for _, b := range buckets {
+		if authenticated && !b.allows(caller) {
+			continue
+		}
+		resp.Buckets = append(resp.Buckets, b.proto())
+	}
+	return resp, nil
+}
+
+// Метод для замены настроек и участников бакета
+func (s *server) UpdateBucket(ctx context.Context, req *pb.UpdateBucketRequest) (*pb.UpdateBucketResponse, error) {
+	settings, err := parseBucketSettings(req.Settings)
+	if err != nil {
+		return nil, err
+	}
+	members, err := parseMembers(req.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := s.lookupBucket(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBucketManager(ctx, b); err != nil {
+		return nil, err
+	}
+
+	b, err = s.meta.updateBucket(b.Name, func(b *bucketRecord) {
+		b.Settings = settings
+		b.Members = members
+	})
+	if errors.Is(err, errBucketNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Bucket not found: %s", req.Name)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to save bucket: %v", err)
+	}
+
+	return &pb.UpdateBucketResponse{Bucket: b.proto()}, nil
+}
+
+// Метод для удаления пустого бакета
+func (s *server) DeleteBucket(ctx context.Context, req *pb.DeleteBucketRequest) (*pb.DeleteBucketResponse, error) {
+	b, err := s.lookupBucket(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBucketManager(ctx, b); err != nil {
+		return nil, err
+	}
+	if b.Name == defaultBucket {
+		return nil, status.Error(codes.FailedPrecondition, "The default bucket cannot be deleted")
+	}
+
+	// Пока бакет удаляется, в него не записываются новые файлы
+	unlock := s.locks.Lock(bucketLockKey(b.Name))
+	defer unlock()
+
+	err = s.meta.deleteBucket(b.Name)
+	if errors.Is(err, errBucketNotEmpty) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Bucket %s is not empty", b.Name)
+	}
+	if errors.Is(err, errBucketNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Bucket not found: %s", b.Name)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to delete bucket: %v", err)
+	}
+
+	return &pb.DeleteBucketResponse{}, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+func TestDeleteBucketOnlyWhenEmpty(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+
+	if _, err := s.CreateBucket(ctx, &pb.CreateBucketRequest{Name: "photos"}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := s.CreateFile(ctx, &pb.CreateFileRequest{Bucket: "photos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name string
+		do   func() error
+		code codes.Code
+	}{
+		{"empty file", nil, codes.FailedPrecondition},
+		{"file in trash", func() error {
+			_, err := s.DeleteFile(ctx, &pb.DeleteFileRequest{Bucket: "photos", Id: f.Id})
+			return err
+		}, codes.FailedPrecondition},
+		{"file purged", func() error {
+			_, err := s.PurgeFile(ctx, &pb.PurgeFileRequest{Bucket: "photos", Id: f.Id})
+			return err
+		}, codes.OK},
+	}
+	for _, step := range steps {
+		if step.do != nil {
+			if err := step.do(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+		}
+		_, err := s.DeleteBucket(ctx, &pb.DeleteBucketRequest{Name: "photos"})
+		if status.Code(err) != step.code {
+			t.Errorf("%s: DeleteBucket: %v, want %v", step.name, err, step.code)
+		}
+	}
+}
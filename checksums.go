@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Контрольные суммы, которые клиент посчитал для отправленного
+// содержимого. Пустая сумма не проверяется
+type expectedChecksums struct {
+	SHA256 string
+	CRC32C string
+}
+
+// Функция для разбора контрольных сумм из запроса. Суммы передаются
+// в шестнадцатеричном виде: SHA-256 - 64 символа, CRC32C - 8
+func parseChecksums(sha, crc string) (expectedChecksums, error) {
+	want := expectedChecksums{SHA256: strings.ToLower(sha), CRC32C: strings.ToLower(crc)}
+	if len(want.SHA256) > 0 && !isHex(want.SHA256, 64) {
+		return want, status.Errorf(codes.InvalidArgument, "Invalid SHA-256 checksum: %q", sha)
+	}
+	if len(want.CRC32C) > 0 && !isHex(want.CRC32C, 8) {
+		return want, status.Errorf(codes.InvalidArgument, "Invalid CRC32C checksum: %q", crc)
+	}
+	return want, nil
+}
+
+// Функция для проверки, что s - шестнадцатеричная строка длины n
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Метод для сверки сохранённого содержимого с ожидаемыми суммами. При
+// расхождении ссылка на блоб освобождается, так что содержимое не остаётся
+// в хранилище, и возвращается DATA_LOSS
+func (s *server) verifyContent(ctx context.Context, sum *contentSummary, want expectedChecksums) error {
+	var err error
+	if len(want.SHA256) > 0 && want.SHA256 != sum.Checksum() {
+		err = status.Errorf(codes.DataLoss, "SHA-256 mismatch: received content has %s, expected %s", sum.Checksum(), want.SHA256)
+	} else if len(want.CRC32C) > 0 && want.CRC32C != sum.CRC32C() {
+		err = status.Errorf(codes.DataLoss, "CRC32C mismatch: received content has %s, expected %s", sum.CRC32C(), want.CRC32C)
+	}
+	if err != nil {
+		s.releaseBlob(ctx, sum.Checksum())
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Ошибка чтения блоба, фрагменты которого короче его размера
+var errChunksTruncated = errors.New("blob chunks are shorter than expected")
+
+// Границы фрагментов определяются содержимым (content-defined chunking):
+// фрагмент заканчивается там, где скользящий хеш последних байт даёт
+// нули в младших разрядах. Поэтому вставка или удаление байт меняет
+// только соседние фрагменты, а остальные совпадают с прежними
+const (
+	chunkMinSize = 256 << 10
+	chunkMaxSize = 4 << 20
+	// Граница ставится при нулевых 20 младших разрядах хеша,
+	// средний размер фрагмента около 1 МиБ
+	chunkMask = 1<<20 - 1
+)
+
+// Таблица случайных значений для скользящего хеша Gear. Таблица
+// не должна меняться: от неё зависят границы фрагментов, и после
+// изменения уже сохранённые фрагменты перестанут совпадать с новыми
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	// Генератор splitmix64 с постоянным начальным значением
+	x := uint64(0x6a09e667f3bcc908)
+	for i := range table {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		table[i] = z ^ z>>31
+	}
+	return table
+}()
+
+// Разбиение потока на фрагменты
+type chunker struct {
+	r   io.Reader
+	buf []byte
+	// Число байт в buf, ещё не отданных во фрагментах
+	n   int
+	eof bool
+}
+
+// Функция для создания разбиения потока r на фрагменты
+func newChunker(r io.Reader) *chunker {
+	return &chunker{r: r, buf: make([]byte, chunkMaxSize)}
+}
+
+// Метод для получения очередного фрагмента. Фрагмент действителен
+// до следующего вызова; в конце потока возвращается io.EOF
+func (c *chunker) Next() ([]byte, error) {
+	if !c.eof && c.n < len(c.buf) {
+		n, err := io.ReadFull(c.r, c.buf[c.n:])
+		c.n += n
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.n == 0 {
+		return nil, io.EOF
+	}
+
+	size := chunkBoundary(c.buf[:c.n])
+
+	chunk := make([]byte, size)
+	copy(chunk, c.buf[:size])
+	c.n = copy(c.buf, c.buf[size:c.n])
+
+	return chunk, nil
+}
+
+// Функция для поиска конца первого фрагмента в data. Хеш зависит только
+// от последних 64 байт, поэтому считается с небольшим запасом до
+// минимального размера фрагмента
+func chunkBoundary(data []byte) int {
+	if len(data) <= chunkMinSize {
+		return len(data)
+	}
+
+	var h uint64
+	for i := chunkMinSize - 64; i < len(data); i++ {
+		h = h<<1 + gearTable[data[i]]
+		if i >= chunkMinSize && h&chunkMask == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// Читатель содержимого блоба из его фрагментов
+type chunkReader struct {
+	ctx     context.Context
+	backend Backend
+	chunks  []chunkRef
+	// Смещение в первом из оставшихся фрагментов
+	offset int64
+	// Число байт, которые осталось прочитать
+	remain int64
+	cur    io.ReadCloser
+}
+
+// Функция для чтения length байт содержимого начиная с offset;
+// отрицательная длина означает чтение до конца
+func newChunkReader(ctx context.Context, backend Backend, chunks []chunkRef, offset, length int64) *chunkReader {
+	var size int64
+	for _, c := range chunks {
+		size += c.Size
+	}
+	if offset > size {
+		offset = size
+	}
+	if length < 0 || offset+length > size {
+		length = size - offset
+	}
+
+	for len(chunks) > 0 && offset >= chunks[0].Size {
+		offset -= chunks[0].Size
+		chunks = chunks[1:]
+	}
+
+	return &chunkReader{ctx: ctx, backend: backend, chunks: chunks, offset: offset, remain: length}
+}
+
+// Метод для чтения очередной порции данных. Фрагменты открываются по мере чтения
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.remain == 0 {
+			return 0, io.EOF
+		}
+		if r.cur == nil {
+			if len(r.chunks) == 0 {
+				return 0, errChunksTruncated
+			}
+			rc, err := r.backend.GetRange(r.ctx, chunkObjectName(r.chunks[0].Hash), r.offset, -1)
+			if err != nil {
+				return 0, err
+			}
+			r.cur = rc
+			r.chunks = r.chunks[1:]
+			r.offset = 0
+		}
+
+		if int64(len(p)) > r.remain {
+			p = p[:r.remain]
+		}
+		n, err := r.cur.Read(p)
+		r.remain -= int64(n)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// Метод для закрытия открытого фрагмента
+func (r *chunkReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
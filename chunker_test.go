@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestChunkBoundary(t *testing.T) {
+	random := randomContent(10, 3*chunkMaxSize)
+	// Нули не дают границы, поэтому фрагмент ограничен максимальным размером
+	zeros := make([]byte, 2*chunkMaxSize)
+
+	tests := []struct {
+		name string
+		data []byte
+		min  int
+		max  int
+	}{
+		{name: "empty", data: nil, min: 0, max: 0},
+		{name: "shorter than min", data: random[:1000], min: 1000, max: 1000},
+		{name: "exactly min", data: random[:chunkMinSize], min: chunkMinSize, max: chunkMinSize},
+		{name: "random", data: random[:chunkMaxSize], min: chunkMinSize + 1, max: chunkMaxSize},
+		{name: "no boundary", data: zeros[:chunkMaxSize], min: chunkMaxSize, max: chunkMaxSize},
+	}
+	for _, tt := range tests {
+		got := chunkBoundary(tt.data)
+		if got < tt.min || got > tt.max {
+			t.Errorf("%s: chunkBoundary = %d, want in [%d, %d]", tt.name, got, tt.min, tt.max)
+		}
+	}
+
+	// Граница зависит только от содержимого перед ней
+	n := chunkBoundary(random[:chunkMaxSize])
+	if n < chunkMaxSize {
+		if got := chunkBoundary(random[:n]); got != n {
+			t.Errorf("chunkBoundary of the first chunk = %d, want %d", got, n)
+		}
+	}
+}
+
+// Функция для разбиения data на фрагменты
+func splitChunks(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	var chunks [][]byte
+	c := newChunker(bytes.NewReader(data))
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk) == 0 || len(chunk) > chunkMaxSize {
+			t.Fatalf("chunk of %d bytes", len(chunk))
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+func TestChunkerSplit(t *testing.T) {
+	data := randomContent(11, 12<<20)
+	chunks := splitChunks(t, data)
+	if len(chunks) < 3 {
+		t.Fatalf("%d chunks, want at least 3", len(chunks))
+	}
+	if joined := bytes.Join(chunks, nil); !bytes.Equal(joined, data) {
+		t.Fatalf("chunks join into %d bytes, want the %d input bytes", len(joined), len(data))
+	}
+
+	// Вставка в середину меняет только соседние фрагменты
+	mid := len(data) / 2
+	edited := append(append(append([]byte{}, data[:mid]...), "inserted"...), data[mid:]...)
+	before := make(map[string]bool)
+	for _, chunk := range chunks {
+		before[sha256Hex(chunk)] = true
+	}
+	var changed int
+	for _, chunk := range splitChunks(t, edited) {
+		if !before[sha256Hex(chunk)] {
+			changed++
+		}
+	}
+	if changed == 0 || changed > 2 {
+		t.Errorf("%d chunks changed after a local edit, want 1 or 2", changed)
+	}
+}
+
+// Функция для сохранения фрагментов в хранилище в памяти
+func storeTestChunks(t *testing.T, parts ...string) (Backend, []chunkRef) {
+	t.Helper()
+	backend := newMemoryBackend()
+	var chunks []chunkRef
+	for _, part := range parts {
+		hash := sha256Hex([]byte(part))
+		if err := backend.Put(context.Background(), chunkObjectName(hash), bytes.NewReader([]byte(part))); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunkRef{Hash: hash, Size: int64(len(part))})
+	}
+	return backend, chunks
+}
+
+func TestChunkReaderRange(t *testing.T) {
+	backend, chunks := storeTestChunks(t, "0123", "45", "6789")
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{0, 4, "0123"},
+		{2, 3, "234"},
+		{4, 2, "45"},
+		{3, 4, "3456"},
+		{5, -1, "56789"},
+		{6, 100, "6789"},
+		{10, -1, ""},
+		{12, 5, ""},
+		{4, 0, ""},
+	}
+	for _, tt := range tests {
+		r := newChunkReader(context.Background(), backend, chunks, tt.offset, tt.length)
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || string(got) != tt.want {
+			t.Errorf("range (%d, %d) = %q, %v, want %q", tt.offset, tt.length, got, err, tt.want)
+		}
+	}
+}
+
+func TestChunkReaderErrors(t *testing.T) {
+	backend, chunks := storeTestChunks(t, "0123", "45")
+
+	// Фрагмент в хранилище короче размера в учёте
+	short := append([]chunkRef{}, chunks...)
+	short[1].Size = 5
+	r := newChunkReader(context.Background(), backend, short, 0, -1)
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, errChunksTruncated) {
+		t.Errorf("read of a truncated chunk: %v, want errChunksTruncated", err)
+	}
+	r.Close()
+
+	// Отсутствующий фрагмент
+	missing := append([]chunkRef{}, chunks...)
+	missing[1].Hash = sha256Hex([]byte("missing"))
+	r = newChunkReader(context.Background(), backend, missing, 0, -1)
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("read of a missing chunk: %v, want ErrObjectNotFound", err)
+	}
+	r.Close()
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"path/filepath"
-	"strings"
 
 	"image"
 	_ "image/jpeg"
@@ -21,34 +24,72 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 
 	pb "C/storage"
 )
 
 // Объявляются глобальные переменные для хранения ошибки "файл не найден" и списка файлов
 var ErrFileNotFound = errors.New("file not found")
+var errModifiedConcurrently = errors.New("Файл изменил или редактирует другой пользователь. Прочитайте его заново")
+var errCorrupted = errors.New("Файл повреждён при передаче. Попробуйте ещё раз")
+var errAccessDenied = errors.New("Нет прав на это действие с файлом. Попросите владельца файла открыть вам доступ")
+var errQuotaExceeded = errors.New("Превышена квота на хранение файлов. Удалите ненужные файлы навсегда в окне \"Корзина\" или обратитесь к администратору")
 var fileList = make(map[string]string)
 
+// ETag файлов на момент их последнего чтения или записи этим клиентом
+var fileETags = make(map[string]string)
+
+// Блокировка файла, открытого для редактирования: пока она действует,
+// другие пользователи не могут изменить или удалить файл
+var editLock struct {
+	id    string
+	token string
+}
+
+// Срок блокировки файла, открытого для редактирования, в секундах
+const editLockTTL = 10 * 60
+
+// Бакет, с файлами которого работает клиент; пустое имя - бакет по умолчанию
+var bucket string
+
 func main() {
-	// Устанавливается путь к директории с файлами
-	dirPath, err := filepath.Abs("./files")
-	if err != nil {
-		log.Fatalf("Ошибка при получении абсолютного пути: %v", err)
+	addr := flag.String("addr", ":50051", "server address")
+	useTLS := flag.Bool("tls", false, "connect over TLS (implied by -tls-ca and -tls-cert)")
+	caFile := flag.String("tls-ca", "", "CA certificate file to verify the server (default: system roots)")
+	certFile := flag.String("tls-cert", "", "client certificate file for mutual TLS")
+	keyFile := flag.String("tls-key", "", "client private key file for mutual TLS")
+	serverName := flag.String("tls-server-name", "", "expected server name in its certificate (default: host from -addr)")
+	token := flag.String("token", "", "API key or JWT sent to the server as a bearer token")
+	flag.StringVar(&bucket, "bucket", "", "bucket to work with (default: the server's default bucket)")
+	flag.Parse()
+
+	secure := *useTLS || len(*caFile) > 0 || len(*certFile) > 0
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if secure {
+		creds, err := tlsCredentials(*caFile, *certFile, *keyFile, *serverName)
+		if err != nil {
+			log.Fatalf("Не удалось загрузить сертификаты: %v", err)
+		}
+		opts[0] = grpc.WithTransportCredentials(creds)
+	}
+	if len(*token) > 0 {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken{token: *token, secure: secure}))
 	}
-	// Считываются все файлы из директории
-	files, err := ioutil.ReadDir(dirPath)
+
+	// Устанавливается соединение с gRPC-сервером
+	conn, err := grpc.Dial(*addr, opts...)
 	if err != nil {
-		log.Fatalf("Ошибка при чтении директории: %v", err)
+		log.Fatalf("Не удалось подключиться: %v", err)
 	}
+	client := pb.NewFileStorageClient(conn)
 
-	// Для каждого файла извлекается имя и расширение, после чего они добавляются в список файлов
-	for _, file := range files {
-		if !file.IsDir() {
-			fileName := filepath.Base(file.Name())
-			ext := filepath.Ext(fileName)
-			fileList[strings.TrimSuffix(fileName, ext)] = ext
-			fmt.Printf("Добавлен файл: %s\n", fileName)
-		}
+	// Список файлов запрашивается у сервера
+	if err := loadFileList(client); err != nil {
+		log.Fatalf("Ошибка при получении списка файлов: %v", err)
 	}
 
 	// Создается новое приложение и окно
@@ -56,13 +97,6 @@ func main() {
 	w := a.NewWindow("Задание")
 	w.Resize(fyne.NewSize(600, 300))
 
-	// Устанавливается соединение с gRPC-сервером
-	conn, err := grpc.Dial(":50051", grpc.WithInsecure())
-	if err != nil {
-		log.Fatalf("Не удалось подключиться: %v", err)
-	}
-	client := pb.NewFileStorageClient(conn)
-
 	// Создаются элементы графического интерфейса для ввода ID файла, выбора его расширения и ввода содержимого файла
 	fileIDEntry := widget.NewEntry()
 	fileIDEntry.SetPlaceHolder("Id файла")
@@ -100,33 +134,50 @@ func main() {
 			return
 		}
 
+		// По контрольной сумме сервер проверяет, что файл дошёл без искажений
+		data := []byte(fileContent.Text)
 		createFileResponse, err := client.CreateFile(context.Background(), &pb.CreateFileRequest{
-			File:      []byte(fileContent.Text),
+			Bucket:    bucket,
+			File:      data,
 			Extension: extension,
+			Sha256:    checksum(data),
 		})
+		if status.Code(err) == codes.DataLoss {
+			dialog.ShowError(errCorrupted, w)
+			return
+		}
+		if status.Code(err) == codes.ResourceExhausted {
+			dialog.ShowError(errQuotaExceeded, w)
+			return
+		}
 		if err != nil {
 			log.Printf("Ошибка при создании файла: %v", err)
 			return
 		}
+		showQuotaWarning(createFileResponse.QuotaWarning, w)
 		fmt.Printf("Файл создан с ID: %s\n", createFileResponse.Id)
 		fileIDEntry.SetText(createFileResponse.Id)
 		extensionSelect.PlaceHolder = "Расширение файла"
 		fileList[createFileResponse.Id] = extension
+		fileETags[createFileResponse.Id] = createFileResponse.Etag
 		fileSelect.Options = getFileList()
 	})
 
 	readFileButton := widget.NewButton("Чтение файла", func() {
 		fileID := fileIDEntry.Text
-		extension := extensionSelect.Selected
-		if len(fileID) == 0 || len(extension) == 0 {
-			dialog.ShowError(errors.New("Пожалуйста, введите ID и выберите расширение файла"), w)
+		if len(fileID) == 0 {
+			dialog.ShowError(errors.New("Пожалуйста, введите ID файла"), w)
 			return
 		}
 
 		readFileResponse, err := client.ReadFile(context.Background(), &pb.ReadFileRequest{
-			Id:        fileID,
-			Extension: extension,
+			Bucket: bucket,
+			Id:     fileID,
 		})
+		if status.Code(err) == codes.PermissionDenied {
+			dialog.ShowError(errAccessDenied, w)
+			return
+		}
 		if err != nil {
 			if err == ErrFileNotFound {
 				dialog.ShowError(errors.New("Файл не найден"), w)
@@ -136,6 +187,29 @@ func main() {
 			}
 			return
 		}
+		if checksum(readFileResponse.File) != readFileResponse.Sha256 {
+			dialog.ShowError(errCorrupted, w)
+			return
+		}
+
+		// Расширение файла сообщает сервер, выбирать его необязательно
+		extension := readFileResponse.Extension
+		fileList[fileID] = extension
+		fileETags[fileID] = readFileResponse.Etag
+
+		// Прочитанный файл блокируется на время редактирования
+		releaseEditLock(client)
+		lockResponse, err := client.AcquireLock(context.Background(), &pb.AcquireLockRequest{
+			Bucket:     bucket,
+			Id:         fileID,
+			TtlSeconds: editLockTTL,
+		})
+		if err != nil {
+			log.Printf("Не удалось заблокировать файл для редактирования: %v", err)
+		} else {
+			editLock.id = fileID
+			editLock.token = lockResponse.LockToken
+		}
 
 		if isImage(readFileResponse.File, extension) {
 			showImage(readFileResponse.File, extension, w)
@@ -146,37 +220,67 @@ func main() {
 
 	updateFileButton := widget.NewButton("Обновить файл", func() {
 		fileID := fileIDEntry.Text
-		extension := extensionSelect.Selected
-		if len(fileID) == 0 || len(extension) == 0 {
-			dialog.ShowError(errors.New("Пожалуйста, введите ID и выберите расширение файла"), w)
+		if len(fileID) == 0 {
+			dialog.ShowError(errors.New("Пожалуйста, введите ID файла"), w)
 			return
 		}
 
+		// Если файл уже изменил другой пользователь, сервер откажет в обновлении
+		data := []byte(fileContent.Text)
 		updateFileResponse, err := client.UpdateFile(context.Background(), &pb.UpdateFileRequest{
+			Bucket:    bucket,
 			Id:        fileID,
-			File:      []byte(fileContent.Text),
-			Extension: extension,
+			File:      data,
+			IfMatch:   fileETags[fileID],
+			LockToken: editLockToken(fileID),
+			Sha256:    checksum(data),
 		})
+		if status.Code(err) == codes.FailedPrecondition {
+			dialog.ShowError(errModifiedConcurrently, w)
+			return
+		}
+		if status.Code(err) == codes.DataLoss {
+			dialog.ShowError(errCorrupted, w)
+			return
+		}
+		if status.Code(err) == codes.PermissionDenied {
+			dialog.ShowError(errAccessDenied, w)
+			return
+		}
+		if status.Code(err) == codes.ResourceExhausted {
+			dialog.ShowError(errQuotaExceeded, w)
+			return
+		}
 		if err != nil {
 			log.Printf("Ошибка при обновлении файла: %v", err)
 			return
 		}
+		showQuotaWarning(updateFileResponse.QuotaWarning, w)
 		fmt.Printf("Файл обновлён: %v\n", updateFileResponse)
-		fileList[fileID] = extension
+		fileETags[fileID] = updateFileResponse.Etag
 	})
 
 	deleteFileButton := widget.NewButton("Удаление файла", func() {
 		fileID := fileIDEntry.Text
-		extension := extensionSelect.Selected
-		if len(fileID) == 0 || len(extension) == 0 {
-			dialog.ShowError(errors.New("Пожалуйста, введите ID и выберите расширение файла"), w)
+		if len(fileID) == 0 {
+			dialog.ShowError(errors.New("Пожалуйста, введите ID файла"), w)
 			return
 		}
 
 		deleteFileResponse, err := client.DeleteFile(context.Background(), &pb.DeleteFileRequest{
+			Bucket:    bucket,
 			Id:        fileID,
-			Extension: extension,
+			IfMatch:   fileETags[fileID],
+			LockToken: editLockToken(fileID),
 		})
+		if status.Code(err) == codes.FailedPrecondition {
+			dialog.ShowError(errModifiedConcurrently, w)
+			return
+		}
+		if status.Code(err) == codes.PermissionDenied {
+			dialog.ShowError(errAccessDenied, w)
+			return
+		}
 		if err != nil {
 			log.Printf("Ошибка при удалении файла: %v", err)
 			dialog.ShowError(errors.New("Файл не найден"), w)
@@ -184,17 +288,30 @@ func main() {
 		}
 		fmt.Printf("Файл удалён: %v\n", deleteFileResponse)
 		delete(fileList, fileID)
+		delete(fileETags, fileID)
+		if editLock.id == fileID {
+			editLock.id, editLock.token = "", ""
+		}
 		fileIDEntry.SetText("")
 		extensionSelect.PlaceHolder = "Расширение файла"
 		fileSelect.Options = getFileList()
 	})
 
+	// Восстановленный из корзины файл снова появляется в списке файлов
+	trashButton := widget.NewButton("Корзина", func() {
+		showTrash(client, w, func(id, extension string) {
+			fileList[id] = extension
+			fileSelect.Options = getFileList()
+		})
+	})
+
 	// Объединяются кнопки в контейнер
 	buttons := container.NewGridWithColumns(2,
 		createFileButton,
 		readFileButton,
 		updateFileButton,
 		deleteFileButton,
+		trashButton,
 	)
 
 	// Объединяются все элементы графического интерфейса в контейнер
@@ -213,6 +330,180 @@ func main() {
 
 }
 
+// Функция для загрузки списка файлов с сервера постранично
+func loadFileList(client pb.FileStorageClient) error {
+	pageToken := ""
+	for {
+		resp, err := client.ListFiles(context.Background(), &pb.ListFilesRequest{Bucket: bucket, PageToken: pageToken})
+		if err != nil {
+			return err
+		}
+		for _, file := range resp.Files {
+			fileList[file.Id] = file.Extension
+			if len(file.Name) > 0 {
+				fmt.Printf("Добавлен файл: %s (%s)\n", file.Id+file.Extension, file.Name)
+			} else {
+				fmt.Printf("Добавлен файл: %s\n", file.Id+file.Extension)
+			}
+		}
+		if len(resp.NextPageToken) == 0 {
+			return nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// Функция для загрузки списка файлов в корзине с сервера постранично
+func loadTrash(client pb.FileStorageClient) ([]*pb.TrashEntry, error) {
+	var entries []*pb.TrashEntry
+	pageToken := ""
+	for {
+		resp, err := client.ListTrash(context.Background(), &pb.ListTrashRequest{Bucket: bucket, PageToken: pageToken})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, resp.Files...)
+		if len(resp.NextPageToken) == 0 {
+			return entries, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// Функция для получения подписи файла в корзине: имя или идентификатор,
+// размер и время удаления
+func trashEntryLabel(entry *pb.TrashEntry) string {
+	name := entry.Id + entry.Extension
+	if len(entry.Name) > 0 {
+		name = entry.Name
+	}
+	deleted := entry.DeleteTime.AsTime().Local().Format("02.01.2006 15:04")
+	return fmt.Sprintf("%s, %d байт, удалён %s", name, entry.Size, deleted)
+}
+
+// Функция для отображения корзины: выбранный файл можно восстановить
+// или удалить окончательно. О восстановленном файле сообщается через restored
+func showTrash(client pb.FileStorageClient, w fyne.Window, restored func(id, extension string)) {
+	entries, err := loadTrash(client)
+	if err != nil {
+		log.Printf("Ошибка при получении списка файлов в корзине: %v", err)
+		dialog.ShowError(errors.New("Не удалось открыть корзину"), w)
+		return
+	}
+	if len(entries) == 0 {
+		dialog.ShowInformation("Корзина", "Корзина пуста", w)
+		return
+	}
+
+	trashWin := fyne.CurrentApp().NewWindow("Корзина")
+	trashWin.Resize(fyne.NewSize(500, 300))
+
+	selected := -1
+	list := widget.NewList(
+		func() int { return len(entries) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(trashEntryLabel(entries[i]))
+		},
+	)
+	list.OnSelected = func(i widget.ListItemID) { selected = i }
+
+	// Функция для удаления файла из списка корзины
+	removeEntry := func(id string) {
+		for i, entry := range entries {
+			if entry.Id == id {
+				entries = append(entries[:i], entries[i+1:]...)
+				break
+			}
+		}
+		selected = -1
+		list.UnselectAll()
+		list.Refresh()
+		if len(entries) == 0 {
+			trashWin.Close()
+		}
+	}
+
+	undeleteButton := widget.NewButton("Восстановить", func() {
+		if selected < 0 {
+			dialog.ShowError(errors.New("Пожалуйста, выберите файл"), trashWin)
+			return
+		}
+		undeleteResponse, err := client.UndeleteFile(context.Background(), &pb.UndeleteFileRequest{
+			Bucket: bucket,
+			Id:     entries[selected].Id,
+		})
+		if status.Code(err) == codes.PermissionDenied {
+			dialog.ShowError(errAccessDenied, trashWin)
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка при восстановлении файла: %v", err)
+			dialog.ShowError(errors.New("Файл не найден в корзине"), trashWin)
+			return
+		}
+		fmt.Printf("Файл восстановлен: %s\n", undeleteResponse.Id)
+		restored(undeleteResponse.Id, undeleteResponse.Extension)
+		removeEntry(undeleteResponse.Id)
+	})
+
+	purgeButton := widget.NewButton("Удалить навсегда", func() {
+		if selected < 0 {
+			dialog.ShowError(errors.New("Пожалуйста, выберите файл"), trashWin)
+			return
+		}
+		entry := entries[selected]
+		dialog.ShowConfirm("Удаление файла", "Удалить файл "+trashEntryLabel(entry)+" без возможности восстановления?", func(ok bool) {
+			if !ok {
+				return
+			}
+			_, err := client.PurgeFile(context.Background(), &pb.PurgeFileRequest{
+				Bucket: bucket,
+				Id:     entry.Id,
+			})
+			if status.Code(err) == codes.PermissionDenied {
+				dialog.ShowError(errAccessDenied, trashWin)
+				return
+			}
+			if err != nil {
+				log.Printf("Ошибка при окончательном удалении файла: %v", err)
+				dialog.ShowError(errors.New("Файл не найден в корзине"), trashWin)
+				return
+			}
+			fmt.Printf("Файл удалён окончательно: %s\n", entry.Id)
+			removeEntry(entry.Id)
+		}, trashWin)
+	})
+
+	buttons := container.NewGridWithColumns(2, undeleteButton, purgeButton)
+	trashWin.SetContent(container.NewBorder(nil, buttons, nil, nil, list))
+	trashWin.Show()
+}
+
+// Функция для получения токена блокировки файла, если он открыт для редактирования
+func editLockToken(fileID string) string {
+	if editLock.id != fileID {
+		return ""
+	}
+	return editLock.token
+}
+
+// Функция для снятия блокировки с ранее открытого для редактирования файла
+func releaseEditLock(client pb.FileStorageClient) {
+	if len(editLock.id) == 0 {
+		return
+	}
+	_, err := client.ReleaseLock(context.Background(), &pb.ReleaseLockRequest{
+		Bucket:    bucket,
+		Id:        editLock.id,
+		LockToken: editLock.token,
+	})
+	if err != nil {
+		log.Printf("Не удалось снять блокировку файла: %v", err)
+	}
+	editLock.id, editLock.token = "", ""
+}
+
 // Функция для получения списка файлов
 func getFileList() []string {
 	var list []string
@@ -232,6 +523,64 @@ func contains(slice []string, s string) bool {
 	return false
 }
 
+// Функция для настройки TLS: сертификат сервера проверяется по центру
+// сертификации из caFile, а при взаимном TLS серверу предъявляется
+// сертификат клиента
+func tlsCredentials(caFile, certFile, keyFile, serverName string) (credentials.TransportCredentials, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: serverName}
+	if len(caFile) > 0 {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("в файле %s нет сертификатов", caFile)
+		}
+	}
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// Токен, который передаётся серверу с каждым запросом
+type bearerToken struct {
+	token  string
+	secure bool
+}
+
+// Метод для получения заголовка с токеном
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+// Метод, сообщающий, можно ли передавать токен только по TLS. Без TLS
+// токен передаётся открыто, что допустимо лишь при разработке
+func (t bearerToken) RequireTransportSecurity() bool {
+	return t.secure
+}
+
+// Функция для предупреждения о превышении мягкой квоты: файл сохранён,
+// но место скоро закончится
+func showQuotaWarning(warning string, w fyne.Window) {
+	if len(warning) == 0 {
+		return
+	}
+	log.Printf("Предупреждение сервера: %s", warning)
+	dialog.ShowInformation("Квота", "Файл сохранён, но место для файлов почти закончилось. Удалите ненужные файлы навсегда в окне \"Корзина\": файлы в корзине тоже занимают место", w)
+}
+
+// Функция для вычисления контрольной суммы SHA-256 содержимого файла
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 // Функция для проверки, является ли файл изображением
 func isImage(data []byte, ext string) bool {
 	img, _, err := image.DecodeConfig(bytes.NewReader(data))
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Хранилище файлов в каталоге на локальном диске
+type diskBackend struct {
+	root string
+}
+
+// Префикс имён временных файлов, в которые записываются объекты
+const diskTempPrefix = ".tmp-"
+
+// Функция для создания хранилища в каталоге root. Временные файлы,
+// оставшиеся после аварийного завершения, удаляются
+func newDiskBackend(root string) (*diskBackend, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	b := &diskBackend{root: root}
+	if err := b.removeTempFiles(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Путь к файлу объекта
+func (b *diskBackend) path(name string) string {
+	return filepath.Join(b.root, filepath.FromSlash(name))
+}
+
+// Метод для сохранения объекта. Данные записываются во временный файл
+// в том же каталоге, который после синхронизации с диском переименовывается,
+// поэтому читатели и сбои никогда не видят частично записанный объект
+func (b *diskBackend) Put(ctx context.Context, name string, r io.Reader) error {
+	path := b.path(name)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, diskTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// TempFile создаёт файл с правами 0600, а объекты доступны для чтения всем
+	if err := os.Chmod(tmp, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(dir)
+
+	return nil
+}
+
+// Функция для синхронизации каталога с диском, чтобы переименование
+// пережило сбой. Ошибка не возвращается: не все системы позволяют
+// синхронизировать каталог
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// Метод для удаления временных файлов, оставшихся от незавершённой записи
+func (b *diskBackend) removeTempFiles() error {
+	return filepath.WalkDir(b.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasPrefix(d.Name(), diskTempPrefix) {
+			return nil
+		}
+
+		log.Printf("Removing orphaned temporary file %s", path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// Метод для открытия объекта
+func (b *diskBackend) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.GetRange(ctx, name, 0, -1)
+}
+
+// Метод для открытия диапазона байт объекта
+func (b *diskBackend) GetRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(b.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFound(name)
+		}
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, notFound(name)
+	}
+
+	if offset > info.Size() {
+		offset = info.Size()
+	}
+	if length < 0 || offset+length > info.Size() {
+		length = info.Size() - offset
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, length), f}, nil
+}
+
+// Метод для получения информации об объекте
+func (b *diskBackend) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	path := b.path(name)
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ObjectInfo{}, notFound(name)
+		}
+		return ObjectInfo{}, err
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, notFound(name)
+	}
+
+	return ObjectInfo{
+		Name:       name,
+		Size:       info.Size(),
+		CreateTime: fileCreateTime(path, info),
+		ModTime:    info.ModTime(),
+	}, nil
+}
+
+// Метод для получения списка объектов. Служебные файлы и каталоги,
+// имена которых начинаются с ".", пропускаются
+func (b *diskBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(b.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == b.root {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		// Файл мог быть удалён между чтением каталога и получением информации
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		objects = append(objects, ObjectInfo{
+			Name:       name,
+			Size:       info.Size(),
+			CreateTime: fileCreateTime(path, info),
+			ModTime:    info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// Метод для удаления объекта
+func (b *diskBackend) Delete(ctx context.Context, name string) error {
+	err := os.Remove(b.path(name))
+	if os.IsNotExist(err) {
+		return notFound(name)
+	}
+	return err
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Функция для вычисления ETag содержимого файла. Номер версии служит
+// счётчиком поколений: он увеличивается при каждой записи файла
+func etag(version int64, checksum string) string {
+	return fmt.Sprintf("%d-%.16s", version, checksum)
+}
+
+// ETag текущего содержимого файла
+func (md *fileMetadata) etag() string {
+	return etag(md.currentVersion(), md.SHA256)
+}
+
+// Функция для проверки условия if_match: если оно задано, ETag файла
+// должен с ним совпадать
+func checkIfMatch(md *fileMetadata, ifMatch string) error {
+	if len(ifMatch) > 0 && ifMatch != md.etag() {
+		return status.Errorf(codes.FailedPrecondition, "File %s has been modified: ETag is %s, not %s", md.ID, md.etag(), ifMatch)
+	}
+	return nil
+}
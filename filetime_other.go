@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// Функция для получения времени создания файла: на этих платформах
+// оно недоступно, поэтому возвращается время изменения
+func fileCreateTime(path string, info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Функция для получения времени создания файла
+func fileCreateTime(path string, info os.FileInfo) time.Time {
+	if attr, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return time.Unix(0, attr.CreationTime.Nanoseconds())
+	}
+	return info.ModTime()
+}
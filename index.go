@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Имя бакета базы с индексами файлов для постраничного вывода списков
+var metadataIndexBucket = []byte("file_index")
+
+// Порядки, в которых индексируются файлы бакета: файлы вне корзины по
+// имени, размеру и времени изменения, файлы в корзине - по времени удаления
+const (
+	nameOrder  = "name"
+	sizeOrder  = "size"
+	timeOrder  = "time"
+	trashOrder = "trash"
+)
+
+// Функция для получения префикса ключей индекса бакета bucket в порядке order.
+// Имена бакетов не содержат "/", поэтому префиксы разных бакетов не пересекаются
+func indexPrefix(bucket, order string) []byte {
+	return []byte(bucket + "/" + order + "/")
+}
+
+// Функция для получения ключа индекса: ключ сортировки и идентификатор файла,
+// который делает ключ уникальным
+func indexKey(bucket, order string, sortKey []byte, id string) []byte {
+	key := indexPrefix(bucket, order)
+	key = append(key, sortKey...)
+	return append(key, id...)
+}
+
+// Функция для ключа сортировки по числу. Числа записываются в порядке
+// от старших байт к младшим, чтобы байтовый порядок ключей совпадал с числовым
+func uint64SortKey(n int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(n))
+	return key
+}
+
+// Функция для ключа сортировки по времени
+func timeSortKey(t time.Time) []byte {
+	return uint64SortKey(t.UnixNano())
+}
+
+// Функция для получения ключей индекса файла md. Имя отделяется от
+// идентификатора нулевым байтом, чтобы более короткое имя шло раньше
+func indexKeys(md *fileMetadata) [][]byte {
+	bucket := md.bucket()
+	if md.deleted() {
+		return [][]byte{indexKey(bucket, trashOrder, timeSortKey(md.DeleteTime), md.ID)}
+	}
+	return [][]byte{
+		indexKey(bucket, nameOrder, []byte(md.Name+"\x00"), md.ID),
+		indexKey(bucket, sizeOrder, uint64SortKey(md.Size), md.ID),
+		indexKey(bucket, timeOrder, timeSortKey(md.UpdateTime), md.ID),
+	}
+}
+
+// Функция для добавления файла md в индекс (sign равен 1) или его
+// удаления из индекса (sign равен -1)
+func indexFile(tx *bolt.Tx, md *fileMetadata, sign int64) error {
+	index := tx.Bucket(metadataIndexBucket)
+	for _, key := range indexKeys(md) {
+		var err error
+		if sign > 0 {
+			err = index.Put(key, []byte(md.ID))
+		} else {
+			err = index.Delete(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Функция для создания индекса. При первом запуске после его появления
+// в индекс вносятся уже записанные файлы
+func ensureFileIndex(tx *bolt.Tx) error {
+	if tx.Bucket(metadataIndexBucket) != nil {
+		return nil
+	}
+	if _, err := tx.CreateBucket(metadataIndexBucket); err != nil {
+		return err
+	}
+	return tx.Bucket(metadataFilesBucket).ForEach(func(k, raw []byte) error {
+		md, err := getMetadata(tx, string(k))
+		if err != nil {
+			return err
+		}
+		return indexFile(tx, md, 1)
+	})
+}
+
+// Метод для обхода файлов бакета bucket в порядке order. Обход начинается
+// после ключа after, полученного в прошлый раз (или с начала, если after
+// пустой), и продолжается, пока fn возвращает true. fn получает ключ файла
+// для продолжения обхода и его метаданные
+func (m *metadataStore) scanIndex(bucket, order string, after []byte, descending bool, fn func(key []byte, md *fileMetadata) bool) error {
+	prefix := indexPrefix(bucket, order)
+	return m.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(metadataIndexBucket).Cursor()
+
+		var k, v []byte
+		switch {
+		case !descending && len(after) == 0:
+			k, v = c.Seek(prefix)
+		case !descending:
+			k, v = c.Seek(append(prefix, after...))
+			if bytes.Equal(k, append(prefix, after...)) {
+				k, v = c.Next()
+			}
+		default:
+			// Обход в обратном порядке начинается с последнего ключа перед
+			// after или перед концом префикса: "/" + 1 = "0"
+			start := append(prefix, after...)
+			if len(after) == 0 {
+				start = append(prefix[:len(prefix)-1:len(prefix)-1], '0')
+			}
+			if k, _ = c.Seek(start); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = step(c, descending) {
+			md, err := getMetadata(tx, string(v))
+			if err != nil {
+				return err
+			}
+			if !fn(k[len(prefix):], md) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// Функция для перехода курсора к следующему ключу в порядке обхода
+func step(c *bolt.Cursor, descending bool) ([]byte, []byte) {
+	if descending {
+		return c.Prev()
+	}
+	return c.Next()
+}
+
+// Функция для получения размера страницы списка
+func pageSize(size int32) (int, error) {
+	if size < 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "Invalid page size: %d", size)
+	}
+	if size == 0 {
+		return defaultPageSize, nil
+	}
+	if size > maxPageSize {
+		return maxPageSize, nil
+	}
+	return int(size), nil
+}
+
+// Функция для получения ключа индекса, после которого начинается страница.
+// Токен страницы - ключ последнего файла предыдущей страницы
+func parsePageToken(token string) ([]byte, error) {
+	after, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid page token: %q", token)
+	}
+	return after, nil
+}
+
+// Функция для получения токена следующей страницы по ключу последнего файла
+func pageToken(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// Функция для получения порядка индекса для сортировки списка файлов
+func sortOrder(sortBy pb.SortBy) (string, error) {
+	switch sortBy {
+	case pb.SortBy_SORT_BY_NAME:
+		return nameOrder, nil
+	case pb.SortBy_SORT_BY_SIZE:
+		return sizeOrder, nil
+	case pb.SortBy_SORT_BY_TIME:
+		return timeOrder, nil
+	default:
+		return "", status.Errorf(codes.InvalidArgument, "Invalid sort order: %v", sortBy)
+	}
+}
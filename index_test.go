@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Функция для получения всех страниц корзины
+func listTrash(t *testing.T, s *server, pageSize int32) []string {
+	t.Helper()
+	var names []string
+	req := &pb.ListTrashRequest{PageSize: pageSize}
+	for {
+		resp, err := s.ListTrash(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range resp.Files {
+			names = append(names, f.Name)
+		}
+		if len(resp.NextPageToken) == 0 {
+			return names
+		}
+		req.PageToken = resp.NextPageToken
+	}
+}
+
+// Функция для получения имён файлов вне корзины в порядке имён
+func listNames(t *testing.T, s *server, req *pb.ListFilesRequest) string {
+	t.Helper()
+	var names []string
+	for _, f := range listAll(t, s, req) {
+		names = append(names, f.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestListIndexFollowsChanges(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+
+	ids := make(map[string]string)
+	for _, name := range []string{"a.txt", "b.png", "c.txt", "d.txt"} {
+		resp, err := s.CreateFile(ctx, &pb.CreateFileRequest{Name: name, Extension: filepath.Ext(name), File: []byte(name)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = resp.Id
+	}
+	for _, name := range []string{"a.txt", "c.txt", "d.txt"} {
+		if _, err := s.DeleteFile(ctx, &pb.DeleteFileRequest{Id: ids[name]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.UndeleteFile(ctx, &pb.UndeleteFileRequest{Id: ids["c.txt"]}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateFile(ctx, &pb.UpdateFileRequest{Id: ids["b.png"], File: []byte("larger content")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := listNames(t, s, &pb.ListFilesRequest{PageSize: 1}); got != "b.png,c.txt" {
+		t.Errorf("files = %s, want b.png,c.txt", got)
+	}
+	if got := listNames(t, s, &pb.ListFilesRequest{Extension: "txt"}); got != "c.txt" {
+		t.Errorf("files with extension txt = %s, want c.txt", got)
+	}
+	if got := strings.Join(listTrash(t, s, 1), ","); got != "d.txt,a.txt" {
+		t.Errorf("trash = %s, want d.txt,a.txt", got)
+	}
+
+	// Индекс, которого нет в каталоге, строится заново при открытии
+	path := s.meta.db.Path()
+	err := s.meta.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(metadataIndexBucket)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.meta.db.Close()
+	if s.meta, err = newMetadataStore(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.meta.db.Close() })
+	if got := listNames(t, s, &pb.ListFilesRequest{SortBy: pb.SortBy_SORT_BY_SIZE, Descending: true}); got != "b.png,c.txt" {
+		t.Errorf("files after rebuilding the index = %s, want b.png,c.txt", got)
+	}
+	if got := strings.Join(listTrash(t, s, 0), ","); got != "d.txt,a.txt" {
+		t.Errorf("trash after rebuilding the index = %s, want d.txt,a.txt", got)
+	}
+}
+
+func TestListInvalidRequest(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+
+	tests := []*pb.ListFilesRequest{
+		{PageSize: -1},
+		{PageToken: "not a token!"},
+		{SortBy: pb.SortBy(42)},
+	}
+	for _, req := range tests {
+		if _, err := s.ListFiles(ctx, req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("ListFiles(%v): %v, want InvalidArgument", req, err)
+		}
+	}
+	if _, err := s.ListTrash(ctx, &pb.ListTrashRequest{PageToken: "not a token!"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListTrash with an invalid token: %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// Как часто проверяется, не изменился ли файл JWKS. Токен с неизвестным
+// идентификатором ключа вызывает проверку сразу
+const jwksCheckInterval = time.Minute
+
+// Открытые ключи из файла JWKS. Файл перечитывается, когда он изменился,
+// поэтому ключи можно менять без перезапуска сервера
+type jwkSet struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	modTime time.Time
+	checked time.Time
+}
+
+// Функция для загрузки набора ключей из файла JWKS
+func newJWKSet(path string) (*jwkSet, error) {
+	set := &jwkSet{path: path, interval: jwksCheckInterval}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if set.keys, err = loadJWKS(path); err != nil {
+		return nil, err
+	}
+	set.modTime = info.ModTime()
+	set.checked = time.Now()
+	return set, nil
+}
+
+// Метод для выбора ключа по идентификатору из заголовка JWT
+func (s *jwkSet) key(kid interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.checked) >= s.interval {
+		s.refresh(now)
+	}
+	key, err := findJWK(s.keys, kid)
+	if err != nil && s.refresh(now) {
+		key, err = findJWK(s.keys, kid)
+	}
+	return key, err
+}
+
+// Метод для повторной загрузки ключей, если файл изменился. Если новый
+// файл не удалось прочитать, остаются прежние ключи. Возвращает true,
+// если ключи обновлены
+func (s *jwkSet) refresh(now time.Time) bool {
+	s.checked = now
+	info, err := os.Stat(s.path)
+	if err != nil {
+		log.Printf("Failed to check JWKS file: %v", err)
+		return false
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return false
+	}
+	keys, err := loadJWKS(s.path)
+	if err != nil {
+		log.Printf("Failed to reload JWKS, keeping the previous keys: %v", err)
+		return false
+	}
+	s.keys = keys
+	s.modTime = info.ModTime()
+	log.Printf("Reloaded %d keys from %s", len(keys), s.path)
+	return true
+}
+
+// Открытый ключ в формате JWK (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// Ключ RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// Ключ ECDSA
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Функция для загрузки открытых ключей из файла JWKS. Ключи
+// возвращаются по их идентификаторам (kid)
+func loadJWKS(path string) (map[string]interface{}, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		// Ключи для шифрования к проверке подписи не относятся
+		if k.Use == "enc" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q in %s: %w", k.Kid, path, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found in %s", path)
+	}
+
+	return keys, nil
+}
+
+// Метод для получения открытого ключа RSA или ECDSA
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeJWKInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// Функция для разбора числа, записанного в base64url без дополнения
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Функция для выбора ключа по идентификатору из заголовка JWT. Если
+// идентификатора нет, подходит только единственный ключ набора
+func findJWK(keys map[string]interface{}, kid interface{}) (interface{}, error) {
+	if id, ok := kid.(string); ok {
+		if key, ok := keys[id]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown key id %q", id)
+	}
+	if len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, errors.New("token has no key id")
+}
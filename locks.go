@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Срок аренды блокировки по умолчанию и наибольший срок
+const (
+	defaultLockTTL = 5 * time.Minute
+	maxLockTTL     = time.Hour
+)
+
+// Блокировка файла и число операций, которые её держат или ждут
+type fileLock struct {
+	sync.RWMutex
+	refs int
+}
+
+// Аренда блокировки файла клиентом
+type lockLease struct {
+	token  string
+	expire time.Time
+}
+
+// Менеджер блокировок файлов по идентификатору. Операции чтения
+// выполняются параллельно, операции изменения - по одной. Кроме того,
+// клиент может арендовать блокировку на время редактирования файла
+type lockManager struct {
+	mu     sync.Mutex
+	locks  map[string]*fileLock
+	leases map[string]*lockLease
+}
+
+// Функция для создания менеджера блокировок
+func newLockManager() *lockManager {
+	return &lockManager{
+		locks:  make(map[string]*fileLock),
+		leases: make(map[string]*lockLease),
+	}
+}
+
+// Метод для получения блокировки файла. Блокировка удаляется,
+// когда её больше никто не держит и не ждёт
+func (m *lockManager) get(id string) *fileLock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.locks[id]
+	if !ok {
+		l = &fileLock{}
+		m.locks[id] = l
+	}
+	l.refs++
+	return l
+}
+
+// Метод для освобождения блокировки, полученной через get
+func (m *lockManager) put(id string, l *fileLock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l.refs--
+	if l.refs == 0 {
+		delete(m.locks, id)
+	}
+}
+
+// Метод для блокировки файла на чтение. Возвращает функцию снятия блокировки
+func (m *lockManager) RLock(id string) func() {
+	l := m.get(id)
+	l.RLock()
+	return func() {
+		l.RUnlock()
+		m.put(id, l)
+	}
+}
+
+// Метод для блокировки файла на изменение. Возвращает функцию снятия блокировки
+func (m *lockManager) Lock(id string) func() {
+	l := m.get(id)
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.put(id, l)
+	}
+}
+
+// Метод для получения действующей аренды файла
+func (m *lockManager) activeLease(id string, now time.Time) (*lockLease, bool) {
+	lease, ok := m.leases[id]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(lease.expire) {
+		delete(m.leases, id)
+		return nil, false
+	}
+	return lease, true
+}
+
+// Метод для выдачи или продления аренды блокировки файла
+func (m *lockManager) lease(id, token string, ttl time.Duration) (*lockLease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for other := range m.leases {
+		m.activeLease(other, now)
+	}
+
+	lease, ok := m.activeLease(id, now)
+	if ok && lease.token != token {
+		return nil, status.Errorf(codes.FailedPrecondition, "File %s is locked until %s", id, lease.expire.Format(time.RFC3339))
+	}
+	if !ok {
+		lease = &lockLease{token: generateFileID()}
+		m.leases[id] = lease
+	}
+	lease.expire = now.Add(ttl)
+
+	copied := *lease
+	return &copied, nil
+}
+
+// Метод для досрочного завершения аренды. Завершение уже истёкшей
+// аренды не считается ошибкой
+func (m *lockManager) release(id, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lease, ok := m.activeLease(id, time.Now())
+	if !ok {
+		return nil
+	}
+	if lease.token != token {
+		return status.Errorf(codes.FailedPrecondition, "File %s is locked by another client", id)
+	}
+	delete(m.leases, id)
+	return nil
+}
+
+// Метод для проверки, что файл не арендован или арендован с токеном token
+func (m *lockManager) checkLease(id, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lease, ok := m.activeLease(id, time.Now())
+	if ok && lease.token != token {
+		return status.Errorf(codes.FailedPrecondition, "File %s is locked until %s", id, lease.expire.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Метод для завершения аренды удалённого файла
+func (m *lockManager) dropLease(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.leases, id)
+}
+
+// Метод для аренды блокировки файла на время редактирования
+func (s *server) AcquireLock(ctx context.Context, req *pb.AcquireLockRequest) (*pb.AcquireLockResponse, error) {
+	if req.TtlSeconds < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid lock TTL: %d", req.TtlSeconds)
+	}
+	ttl := time.Duration(req.TtlSeconds) * time.Second
+	if ttl == 0 {
+		ttl = defaultLockTTL
+	}
+	if ttl > maxLockTTL {
+		ttl = maxLockTTL
+	}
+
+	unlock := s.locks.RLock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupMetadata(ctx, req.Bucket, req.Id, req.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permWrite); err != nil {
+		return nil, err
+	}
+
+	lease, err := s.locks.lease(md.ID, req.LockToken, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.AcquireLockResponse{LockToken: lease.token, ExpireTime: timestamppb.New(lease.expire)}, nil
+}
+
+// Метод для досрочного снятия арендованной блокировки
+func (s *server) ReleaseLock(ctx context.Context, req *pb.ReleaseLockRequest) (*pb.ReleaseLockResponse, error) {
+	if _, err := s.lookupAnyMetadata(ctx, req.Bucket, req.Id); err != nil {
+		return nil, err
+	}
+
+	if err := s.locks.release(req.Id, req.LockToken); err != nil {
+		return nil, err
+	}
+
+	return &pb.ReleaseLockResponse{}, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Хранилище файлов в оперативной памяти, используется для тестов
+type memoryBackend struct {
+	mu      sync.RWMutex
+	objects map[string]*memoryObject
+}
+
+// Объект в оперативной памяти
+type memoryObject struct {
+	data       []byte
+	createTime time.Time
+	modTime    time.Time
+}
+
+// Функция для создания хранилища в памяти
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{objects: make(map[string]*memoryObject)}
+}
+
+// Метод для сохранения объекта
+func (b *memoryBackend) Put(ctx context.Context, name string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	obj := &memoryObject{data: data, createTime: now, modTime: now}
+	if old, ok := b.objects[name]; ok {
+		obj.createTime = old.createTime
+	}
+	b.objects[name] = obj
+
+	return nil
+}
+
+// Метод для открытия объекта
+func (b *memoryBackend) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.GetRange(ctx, name, 0, -1)
+}
+
+// Метод для открытия диапазона байт объекта. Данные объекта не изменяются
+// после сохранения, поэтому копировать их не нужно
+func (b *memoryBackend) GetRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	b.mu.RLock()
+	obj, ok := b.objects[name]
+	b.mu.RUnlock()
+	if !ok {
+		return nil, notFound(name)
+	}
+
+	size := int64(len(obj.data))
+	if offset > size {
+		offset = size
+	}
+	if length < 0 || offset+length > size {
+		length = size - offset
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(obj.data[offset : offset+length])), nil
+}
+
+// Метод для получения информации об объекте
+func (b *memoryBackend) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	obj, ok := b.objects[name]
+	if !ok {
+		return ObjectInfo{}, notFound(name)
+	}
+	return obj.info(name), nil
+}
+
+// Метод для получения списка объектов
+func (b *memoryBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var objects []ObjectInfo
+	for name, obj := range b.objects {
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, obj.info(name))
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+
+	return objects, nil
+}
+
+// Метод для удаления объекта
+func (b *memoryBackend) Delete(ctx context.Context, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.objects[name]; !ok {
+		return notFound(name)
+	}
+	delete(b.objects, name)
+
+	return nil
+}
+
+// Информация об объекте в памяти
+func (obj *memoryObject) info(name string) ObjectInfo {
+	return ObjectInfo{
+		Name:       name,
+		Size:       int64(len(obj.data)),
+		CreateTime: obj.createTime,
+		ModTime:    obj.modTime,
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Ошибка, возвращаемая каталогом, если метаданных файла нет
+var errMetadataNotFound = errors.New("metadata not found")
+
+// Имена бакетов базы: метаданные файлов и служебные отметки каталога
+var (
+	metadataFilesBucket = []byte("files")
+	metadataStateBucket = []byte("state")
+)
+
+// Метаданные файла
+type fileMetadata struct {
+	ID          string            `json:"id"`
+	Bucket      string            `json:"bucket,omitempty"`
+	Extension   string            `json:"extension"`
+	Name        string            `json:"name,omitempty"`
+	ContentType string            `json:"content_type"`
+	Size        int64             `json:"size"`
+	SHA256      string            `json:"sha256"`
+	CRC32C      string            `json:"crc32c,omitempty"`
+	CreateTime  time.Time         `json:"create_time"`
+	UpdateTime  time.Time         `json:"update_time"`
+	Owner       string            `json:"owner,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Version     int64             `json:"version"`
+	Versions    []fileVersion     `json:"versions,omitempty"`
+	// Права других пользователей и групп на файл
+	ACL []aclEntry `json:"acl,omitempty"`
+	// Время перемещения файла в корзину; нулевое, если файл не удалён
+	DeleteTime time.Time `json:"delete_time"`
+}
+
+// Каталог метаданных файлов во встроенной базе bbolt
+type metadataStore struct {
+	db *bolt.DB
+}
+
+// Функция для открытия каталога метаданных по пути path
+func newMetadataStore(path string) (*metadataStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{metadataFilesBucket, metadataBucketsBucket, metadataBlobsBucket, metadataChunksBucket, metadataCorruptedBucket, metadataStateBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if err := ensureUsageCounters(tx); err != nil {
+			return err
+		}
+		if err := ensureFileIndex(tx); err != nil {
+			return err
+		}
+		return ensureDefaultBucket(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &metadataStore{db: db}, nil
+}
+
+// Метод для получения метаданных файла
+func (m *metadataStore) Get(id string) (*fileMetadata, error) {
+	var md *fileMetadata
+	err := m.db.View(func(tx *bolt.Tx) error {
+		var err error
+		md, err = getMetadata(tx, id)
+		return err
+	})
+	return md, err
+}
+
+// Метод для сохранения метаданных файла
+func (m *metadataStore) Put(md *fileMetadata) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		return putMetadata(tx, md)
+	})
+}
+
+// Метод для изменения метаданных файла в одной транзакции.
+// Если метаданных нет, fn получает nil
+func (m *metadataStore) Update(id string, fn func(md *fileMetadata) (*fileMetadata, error)) (*fileMetadata, error) {
+	var result *fileMetadata
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		md, err := getMetadata(tx, id)
+		if err != nil && !errors.Is(err, errMetadataNotFound) {
+			return err
+		}
+
+		result, err = fn(md)
+		if err != nil {
+			return err
+		}
+		return putMetadata(tx, result)
+	})
+	return result, err
+}
+
+// Метод для получения метаданных всех файлов
+func (m *metadataStore) List() ([]*fileMetadata, error) {
+	var files []*fileMetadata
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(metadataFilesBucket).ForEach(func(k, raw []byte) error {
+			md := &fileMetadata{}
+			if err := json.Unmarshal(raw, md); err != nil {
+				return err
+			}
+			files = append(files, md)
+			return nil
+		})
+	})
+	return files, err
+}
+
+// Метод для удаления метаданных файла
+func (m *metadataStore) Delete(id string) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		md, err := getMetadata(tx, id)
+		if errors.Is(err, errMetadataNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := addUsage(tx, md, -1); err != nil {
+			return err
+		}
+		if err := indexFile(tx, md, -1); err != nil {
+			return err
+		}
+		return tx.Bucket(metadataFilesBucket).Delete([]byte(id))
+	})
+}
+
+// Функция для чтения метаданных в транзакции
+func getMetadata(tx *bolt.Tx, id string) (*fileMetadata, error) {
+	raw := tx.Bucket(metadataFilesBucket).Get([]byte(id))
+	if raw == nil {
+		return nil, errMetadataNotFound
+	}
+
+	md := &fileMetadata{}
+	if err := json.Unmarshal(raw, md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// Функция для записи метаданных в транзакции. Счётчики занятого места
+// изменяются на разницу между прежними и новыми метаданными, а в индексе
+// прежние ключи файла заменяются новыми
+func putMetadata(tx *bolt.Tx, md *fileMetadata) error {
+	old, err := getMetadata(tx, md.ID)
+	if err == nil {
+		err = addUsage(tx, old, -1)
+		if err == nil {
+			err = indexFile(tx, old, -1)
+		}
+	}
+	if err != nil && !errors.Is(err, errMetadataNotFound) {
+		return err
+	}
+	if err := addUsage(tx, md, 1); err != nil {
+		return err
+	}
+	if err := indexFile(tx, md, 1); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(metadataFilesBucket).Put([]byte(md.ID), raw)
+}
+
+// Метод для преобразования метаданных в сообщение gRPC
+func (md *fileMetadata) proto() *pb.FileMetadata {
+	return &pb.FileMetadata{
+		Id:          md.ID,
+		Bucket:      md.bucket(),
+		Extension:   md.Extension,
+		Name:        md.Name,
+		ContentType: md.ContentType,
+		Size:        md.Size,
+		Sha256:      md.SHA256,
+		CreateTime:  timestamppb.New(md.CreateTime),
+		UpdateTime:  timestamppb.New(md.UpdateTime),
+		Owner:       md.Owner,
+		Labels:      md.Labels,
+		Version:     md.currentVersion(),
+		Etag:        md.etag(),
+		Crc32C:      md.CRC32C,
+	}
+}
+
+// Таблица для вычисления CRC32C (полином Castagnoli)
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Сводка о содержимом файла: размер, SHA-256, CRC32C и начальные байты
+// для определения типа. Заполняется по мере записи данных
+type contentSummary struct {
+	hash hash.Hash
+	crc  hash.Hash32
+	size int64
+	head []byte
+}
+
+// Функция для создания пустой сводки
+func newContentSummary() *contentSummary {
+	return &contentSummary{hash: sha256.New(), crc: crc32.New(crc32cTable)}
+}
+
+// Метод для учёта очередной порции данных
+func (c *contentSummary) Write(p []byte) (int, error) {
+	if need := 512 - len(c.head); need > 0 {
+		if need > len(p) {
+			need = len(p)
+		}
+		c.head = append(c.head, p[:need]...)
+	}
+	c.size += int64(len(p))
+	c.crc.Write(p)
+	return c.hash.Write(p)
+}
+
+// Метод для получения контрольной суммы SHA-256
+func (c *contentSummary) Checksum() string {
+	return hex.EncodeToString(c.hash.Sum(nil))
+}
+
+// Метод для получения контрольной суммы CRC32C
+func (c *contentSummary) CRC32C() string {
+	return fmt.Sprintf("%08x", c.crc.Sum32())
+}
+
+// Метод для определения MIME-типа: по расширению, а если оно
+// неизвестно - по содержимому
+func (c *contentSummary) ContentType(ext string) string {
+	if t := mime.TypeByExtension(ext); len(t) > 0 {
+		return t
+	}
+	return http.DetectContentType(c.head)
+}
+
+// Метод для записи метаданных нового или изменённого файла в бакете.
+// Владельцем нового файла становится пользователь, выполняющий запрос. Имя,
+// владелец, метки и время создания существующего файла сохраняются.
+// Номер текущей версии увеличивается при каждой записи, даже если бакет
+// не хранит версии: от него зависит ETag. Если предыдущее содержимое
+// сохранено как версия archived, она добавляется в историю.
+// В той же транзакции проверяются квоты владельца и бакета; возвращается
+// предупреждение о превышении мягкой квоты
+func (s *server) recordFile(ctx context.Context, bucket, id, ext, name string, content fileContent, archived *fileVersion) (*fileMetadata, string, error) {
+	// Бакет могли удалить, пока файл записывался в хранилище
+	unlock := s.locks.RLock(bucketLockKey(bucket))
+	defer unlock()
+	b, err := s.meta.getBucket(bucket)
+	if err != nil {
+		if errors.Is(err, errBucketNotFound) {
+			return nil, "", status.Errorf(codes.NotFound, "Bucket not found: %s", bucket)
+		}
+		return nil, "", status.Errorf(codes.Internal, "Failed to read bucket: %v", err)
+	}
+
+	md, warning, err := s.meta.updateWithinQuota(id, s.quotas, b, func(md *fileMetadata) (*fileMetadata, error) {
+		now := time.Now()
+		if md == nil {
+			md = &fileMetadata{ID: id, Bucket: bucket, CreateTime: now, Version: 1}
+			if caller, ok := identityFromContext(ctx); ok {
+				md.Owner = caller.Subject
+			}
+		} else {
+			md.Version = md.currentVersion() + 1
+		}
+		if archived != nil {
+			md.Versions = append(md.Versions, *archived)
+		}
+		if len(name) > 0 {
+			md.Name = name
+		}
+		md.Extension = ext
+		md.ContentType = content.ContentType
+		md.Size = content.Size
+		md.SHA256 = content.SHA256
+		md.CRC32C = content.CRC32C
+		md.UpdateTime = now
+		return md, nil
+	})
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, "", err
+		}
+		return nil, "", status.Errorf(codes.Internal, "Failed to save metadata: %v", err)
+	}
+	if len(warning) > 0 {
+		log.Printf("%s", warning)
+	}
+	return md, warning, nil
+}
+
+// Метод для замены содержимого файла md в бакете b. Прежнее содержимое
+// сохраняется как версия, а если бакет не хранит версии, его блоб освобождается
+func (s *server) replaceContent(ctx context.Context, b *bucketRecord, md *fileMetadata, content fileContent) (*fileMetadata, string, error) {
+	previous, archived := md.SHA256, b.archive(md)
+	md, warning, err := s.recordFile(ctx, b.Name, md.ID, md.Extension, "", content, archived)
+	if err != nil {
+		return nil, "", err
+	}
+	if archived == nil {
+		s.releaseBlob(ctx, previous)
+	}
+	return md, warning, nil
+}
+
+// Метод для получения метаданных файла бакета по идентификатору. Расширение
+// необязательно, но если оно указано, то должно совпадать с расширением файла.
+// Файлы других бакетов неотличимы от несуществующих
+func (s *server) lookupMetadata(ctx context.Context, bucket, id, ext string) (*fileMetadata, error) {
+	b, err := s.lookupBucket(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := objectName(id, ext); err != nil {
+		return nil, err
+	}
+
+	md, err := s.meta.Get(id)
+	if errors.Is(err, errMetadataNotFound) {
+		return nil, status.Errorf(codes.NotFound, "File not found: %s", id)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to read metadata: %v", err)
+	}
+
+	if md.bucket() != b.Name {
+		return nil, status.Errorf(codes.NotFound, "File not found: %s", id)
+	}
+	if md.deleted() {
+		return nil, status.Errorf(codes.NotFound, "File %s is in trash", id)
+	}
+	if len(ext) > 0 && md.Extension != ext {
+		return nil, status.Errorf(codes.NotFound, "File %s has extension %q, not %q", id, md.Extension, ext)
+	}
+	return md, nil
+}
+
+// Метод для переноса объекта id+ext в блоб и записи его метаданных
+func (s *server) importObject(ctx context.Context, id, ext string) (*fileMetadata, error) {
+	name := id + ext
+	info, err := s.backend.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.backend.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := s.putBlob(ctx, r)
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.backend.Delete(ctx, name); err != nil {
+		s.releaseBlob(ctx, sum.Checksum())
+		return nil, err
+	}
+
+	md := &fileMetadata{
+		ID:          id,
+		Extension:   ext,
+		ContentType: sum.ContentType(ext),
+		Size:        sum.size,
+		SHA256:      sum.Checksum(),
+		CRC32C:      sum.CRC32C(),
+		CreateTime:  info.CreateTime,
+		UpdateTime:  info.ModTime,
+		Version:     1,
+	}
+	if err := s.meta.Put(md); err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to save metadata: %v", err)
+	}
+
+	return md, nil
+}
+
+// Метод для получения метаданных файла
+func (s *server) GetMetadata(ctx context.Context, req *pb.GetMetadataRequest) (*pb.GetMetadataResponse, error) {
+	unlock := s.locks.RLock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupMetadata(ctx, req.Bucket, req.Id, req.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permRead); err != nil {
+		return nil, err
+	}
+
+	return &pb.GetMetadataResponse{Metadata: md.proto()}, nil
+}
+
+// Метод для изменения имени, типа содержимого и меток файла
+func (s *server) SetMetadata(ctx context.Context, req *pb.SetMetadataRequest) (*pb.SetMetadataResponse, error) {
+	unlock := s.locks.Lock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupMetadata(ctx, req.Bucket, req.Id, req.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permWrite); err != nil {
+		return nil, err
+	}
+	if err := s.locks.checkLease(md.ID, req.LockToken); err != nil {
+		return nil, err
+	}
+
+	md, err = s.meta.Update(md.ID, func(md *fileMetadata) (*fileMetadata, error) {
+		if md == nil {
+			return nil, errMetadataNotFound
+		}
+		if len(req.Name) > 0 {
+			md.Name = req.Name
+		}
+		if len(req.ContentType) > 0 {
+			md.ContentType = req.ContentType
+		}
+		for _, key := range req.RemoveLabels {
+			delete(md.Labels, key)
+		}
+		for key, value := range req.Labels {
+			if md.Labels == nil {
+				md.Labels = make(map[string]string)
+			}
+			md.Labels[key] = value
+		}
+		return md, nil
+	})
+	if errors.Is(err, errMetadataNotFound) {
+		return nil, status.Errorf(codes.NotFound, "File not found: %s", req.Id)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to save metadata: %v", err)
+	}
+
+	return &pb.SetMetadataResponse{Metadata: md.proto()}, nil
+}
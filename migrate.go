@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Имя объекта хранилища с идентификатором каталога метаданных, которому
+// принадлежит хранилище
+const storageOwnerObject = ".catalog-owner"
+
+// Ключи служебных отметок каталога: идентификатор каталога и отметка
+// о том, что файлы, положенные в хранилище помимо сервера, внесены в каталог
+var (
+	catalogIDKey       = []byte("catalog_id")
+	looseFilesImported = []byte("loose_files_imported")
+)
+
+// Метод для проверки наличия отметки в каталоге
+func (m *metadataStore) hasMark(key []byte) (bool, error) {
+	var ok bool
+	err := m.db.View(func(tx *bolt.Tx) error {
+		ok = tx.Bucket(metadataStateBucket).Get(key) != nil
+		return nil
+	})
+	return ok, err
+}
+
+// Метод для установки отметки в каталоге
+func (m *metadataStore) setMark(key []byte) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metadataStateBucket).Put(key, []byte{1})
+	})
+}
+
+// Метод для получения идентификатора каталога; он создаётся при первом вызове
+func (m *metadataStore) catalogID() (string, error) {
+	var id string
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		state := tx.Bucket(metadataStateBucket)
+		if raw := state.Get(catalogIDKey); raw != nil {
+			id = string(raw)
+			return nil
+		}
+		id = generateFileID()
+		return state.Put(catalogIDKey, []byte(id))
+	})
+	return id, err
+}
+
+// Метод для подготовки хранилища при запуске: хранилище закрепляется
+// за каталогом, а при первом запуске с этим каталогом в него вносятся
+// файлы, добавленные в хранилище помимо сервера. Для этого нужен список
+// всех объектов хранилища, поэтому при следующих запусках он не читается
+func (s *server) prepareStorage(ctx context.Context, claim bool) error {
+	if err := s.claimStorage(ctx, claim); err != nil {
+		return err
+	}
+
+	imported, err := s.meta.hasMark(looseFilesImported)
+	if err != nil || imported {
+		return err
+	}
+	if err := s.importLooseFiles(ctx); err != nil {
+		return err
+	}
+	return s.meta.setMark(looseFilesImported)
+}
+
+// Метод для закрепления хранилища за каталогом метаданных. Ссылки на
+// фрагменты учитываются в каталоге, поэтому сервер с другим каталогом
+// удалял бы фрагменты, которые нужны файлам этого. Хранилище, закреплённое
+// за другим каталогом, забирается только при claim
+func (s *server) claimStorage(ctx context.Context, claim bool) error {
+	id, err := s.meta.catalogID()
+	if err != nil {
+		return err
+	}
+
+	owner, err := s.storageOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if owner == id {
+		return nil
+	}
+	if len(owner) > 0 {
+		if !claim {
+			return fmt.Errorf("storage belongs to metadata catalog %s, not to this catalog %s; "+
+				"use -claim-storage once no other server uses the storage", owner, id)
+		}
+		log.Printf("Taking over storage from metadata catalog %s", owner)
+	}
+
+	if err := s.backend.Put(ctx, storageOwnerObject, strings.NewReader(id)); err != nil {
+		return err
+	}
+	// Другой сервер мог закрепить хранилище за собой одновременно с этим
+	owner, err = s.storageOwner(ctx)
+	if err != nil {
+		return err
+	}
+	if owner != id {
+		return fmt.Errorf("storage has just been claimed by metadata catalog %s", owner)
+	}
+	return nil
+}
+
+// Метод для получения идентификатора каталога, за которым закреплено
+// хранилище; пустая строка, если хранилище ещё не закреплено
+func (s *server) storageOwner(ctx context.Context) (string, error) {
+	r, err := s.backend.Get(ctx, storageOwnerObject)
+	if errors.Is(err, ErrObjectNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	owner, err := ioutil.ReadAll(r)
+	return string(owner), err
+}
+
+// Метод для внесения в каталог файлов, добавленных в хранилище помимо
+// сервера. Такие файлы лежат в корне хранилища под именем id+ext
+func (s *server) importLooseFiles(ctx context.Context) error {
+	objects, err := s.backend.List(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	imported := 0
+	for _, obj := range objects {
+		// Вложенные объекты - служебные данные хранилища, а не файлы
+		if strings.Contains(obj.Name, "/") {
+			continue
+		}
+		ext := filepath.Ext(obj.Name)
+		id := strings.TrimSuffix(obj.Name, ext)
+		if _, err := objectName(id, ext); err != nil {
+			continue
+		}
+
+		_, err := s.meta.Get(id)
+		if err == nil {
+			log.Printf("Skipping file %s: id %s is already in use", obj.Name, id)
+			continue
+		}
+		if !errors.Is(err, errMetadataNotFound) {
+			return err
+		}
+
+		if _, err := s.importObject(ctx, id, ext); err != nil {
+			return err
+		}
+		imported++
+	}
+	if imported > 0 {
+		log.Printf("Imported %d files added to the storage directly", imported)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClaimStorage(t *testing.T) {
+	ctx := context.Background()
+	first := newTestServer(t)
+	second := newTestServer(t)
+	second.backend = first.backend
+
+	if err := first.prepareStorage(ctx, false); err != nil {
+		t.Fatalf("first start: %v", err)
+	}
+	if err := first.prepareStorage(ctx, false); err != nil {
+		t.Fatalf("restart with the same catalog: %v", err)
+	}
+	if err := second.prepareStorage(ctx, false); err == nil {
+		t.Fatal("second catalog started with storage of the first one")
+	}
+	if err := second.prepareStorage(ctx, true); err != nil {
+		t.Fatalf("claim by the second catalog: %v", err)
+	}
+	if err := first.prepareStorage(ctx, false); err == nil {
+		t.Error("first catalog started with storage claimed by the second one")
+	}
+}
+
+func TestImportLooseFilesOnce(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+
+	// Функция для записи файла в хранилище помимо сервера
+	putLoose := func() string {
+		id := generateFileID()
+		if err := s.backend.Put(ctx, id+".txt", bytes.NewReader([]byte("loose "+id))); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	first := putLoose()
+	if err := s.prepareStorage(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.meta.Get(first); err != nil {
+		t.Fatalf("loose file was not imported at the first start: %v", err)
+	}
+
+	second := putLoose()
+	if err := s.prepareStorage(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.meta.Get(second); !errors.Is(err, errMetadataNotFound) {
+		t.Errorf("loose file added later: %v, want errMetadataNotFound", err)
+	}
+}
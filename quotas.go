@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Квота на объём файлов с версиями и число файлов; 0 - без ограничения.
+// Жёсткая квота запрещает запись, мягкая - только предупреждает
+type quota struct {
+	HardBytes   int64 `json:"hard_bytes,omitempty"`
+	SoftBytes   int64 `json:"soft_bytes,omitempty"`
+	HardObjects int64 `json:"hard_objects,omitempty"`
+	SoftObjects int64 `json:"soft_objects,omitempty"`
+}
+
+// Квоты пользователей из файла конфигурации
+type quotaConfig struct {
+	// Квота пользователей, для которых нет отдельной записи
+	Default quota            `json:"default"`
+	Users   map[string]quota `json:"users"`
+}
+
+// Занятое место: объём файлов с их версиями и число файлов.
+// Файлы в корзине учитываются, пока не удалены окончательно
+type usage struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+}
+
+// Имя бакета базы со счётчиками места, занятого пользователями и бакетами
+var metadataUsageBucket = []byte("usage")
+
+// Ключ счётчика места, занятого файлами владельца
+func ownerUsageKey(owner string) string {
+	return "user/" + owner
+}
+
+// Ключ счётчика места, занятого файлами бакета
+func bucketUsageKey(bucket string) string {
+	return "bucket/" + bucket
+}
+
+// Сводные счётчики хранилища для GetStorageStats
+type storageTotals struct {
+	Files        int64 `json:"files"`
+	DeletedFiles int64 `json:"deleted_files"`
+	Versions     int64 `json:"versions"`
+	LogicalBytes int64 `json:"logical_bytes"`
+	Blobs        int64 `json:"blobs"`
+	Chunks       int64 `json:"chunks"`
+	StoredBytes  int64 `json:"stored_bytes"`
+}
+
+// Ключ сводных счётчиков хранилища. Он не совпадает с ключами
+// счётчиков владельцев и бакетов, так как не содержит "/"
+const storageTotalsKey = "totals"
+
+// Функция для изменения сводных счётчиков на delta
+func addTotals(tx *bolt.Tx, delta storageTotals) error {
+	counters := tx.Bucket(metadataUsageBucket)
+
+	var t storageTotals
+	if _, err := getRecord(counters, storageTotalsKey, &t); err != nil {
+		return err
+	}
+	t.Files += delta.Files
+	t.DeletedFiles += delta.DeletedFiles
+	t.Versions += delta.Versions
+	t.LogicalBytes += delta.LogicalBytes
+	t.Blobs += delta.Blobs
+	t.Chunks += delta.Chunks
+	t.StoredBytes += delta.StoredBytes
+	return putRecord(counters, storageTotalsKey, &t)
+}
+
+// Метод для получения сводных счётчиков хранилища
+func (m *metadataStore) totals() (storageTotals, error) {
+	var t storageTotals
+	err := m.db.View(func(tx *bolt.Tx) error {
+		_, err := getRecord(tx.Bucket(metadataUsageBucket), storageTotalsKey, &t)
+		return err
+	})
+	return t, err
+}
+
+// Функция для загрузки квот пользователей. Без файла квоты не ограничены
+func loadQuotaConfig(path string) (*quotaConfig, error) {
+	cfg := &quotaConfig{}
+	if len(path) == 0 {
+		return cfg, nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.Default.validate(); err != nil {
+		return nil, fmt.Errorf("default quota: %w", err)
+	}
+	for user, q := range cfg.Users {
+		if err := q.validate(); err != nil {
+			return nil, fmt.Errorf("quota of %s: %w", user, err)
+		}
+	}
+	return cfg, nil
+}
+
+// Метод для получения квоты пользователя
+func (c *quotaConfig) forUser(subject string) quota {
+	if q, ok := c.Users[subject]; ok {
+		return q
+	}
+	return c.Default
+}
+
+// Метод для проверки, что значения квоты не отрицательны
+func (q quota) validate() error {
+	if q.HardBytes < 0 || q.SoftBytes < 0 || q.HardObjects < 0 || q.SoftObjects < 0 {
+		return fmt.Errorf("quota limits must not be negative")
+	}
+	return nil
+}
+
+// Метод для проверки квот владельца owner и бакета b перед записью ещё
+// bytes байт и objects файлов. Возвращает предупреждение о превышении
+// мягкой квоты. Квота пользователя без имени не проверяется
+func (c *quotaConfig) check(owner string, byOwner usage, b *bucketRecord, byBucket usage, bytes, objects int64) (string, error) {
+	var warning string
+	if len(owner) > 0 {
+		var err error
+		warning, err = c.forUser(owner).check(byOwner, bytes, objects, "user "+owner)
+		if err != nil {
+			return "", err
+		}
+	}
+	bucketWarning, err := b.Settings.Quota.check(byBucket, bytes, objects, "bucket "+b.Name)
+	if err != nil {
+		return "", err
+	}
+	if len(warning) == 0 {
+		warning = bucketWarning
+	}
+	return warning, nil
+}
+
+// Метод для проверки, поместятся ли в квоту ещё bytes байт и objects файлов.
+// При превышении мягкой квоты возвращается предупреждение
+func (q quota) check(u usage, bytes, objects int64, scope string) (string, error) {
+	if bytes > 0 && q.HardBytes > 0 && u.Bytes+bytes > q.HardBytes {
+		return "", status.Errorf(codes.ResourceExhausted, "Storage quota of %s exceeded: %d of %d bytes used, %d more requested", scope, u.Bytes, q.HardBytes, bytes)
+	}
+	if objects > 0 && q.HardObjects > 0 && u.Objects+objects > q.HardObjects {
+		return "", status.Errorf(codes.ResourceExhausted, "File quota of %s exceeded: %d of %d files used", scope, u.Objects, q.HardObjects)
+	}
+	if bytes > 0 && q.SoftBytes > 0 && u.Bytes+bytes > q.SoftBytes {
+		return fmt.Sprintf("Soft storage quota of %s exceeded: %d of %d bytes used", scope, u.Bytes+bytes, q.SoftBytes), nil
+	}
+	if objects > 0 && q.SoftObjects > 0 && u.Objects+objects > q.SoftObjects {
+		return fmt.Sprintf("Soft file quota of %s exceeded: %d of %d files used", scope, u.Objects+objects, q.SoftObjects), nil
+	}
+	return "", nil
+}
+
+// Метод для преобразования квоты в сообщение gRPC
+func (q quota) proto() *pb.Quota {
+	return &pb.Quota{
+		HardBytes:   q.HardBytes,
+		SoftBytes:   q.SoftBytes,
+		HardObjects: q.HardObjects,
+		SoftObjects: q.SoftObjects,
+	}
+}
+
+// Функция для разбора квоты из запроса
+func parseQuota(q *pb.Quota) (quota, error) {
+	if q == nil {
+		return quota{}, nil
+	}
+	parsed := quota{HardBytes: q.HardBytes, SoftBytes: q.SoftBytes, HardObjects: q.HardObjects, SoftObjects: q.SoftObjects}
+	if err := parsed.validate(); err != nil {
+		return quota{}, status.Errorf(codes.InvalidArgument, "Invalid quota: %v", err)
+	}
+	return parsed, nil
+}
+
+// Объём содержимого файла вместе с его версиями
+func (md *fileMetadata) logicalSize() int64 {
+	size := md.Size
+	for _, v := range md.Versions {
+		size += v.Size
+	}
+	return size
+}
+
+// Метод для получения места, занятого файлами владельца owner
+// и файлами бакета bucket
+func (m *metadataStore) usage(owner, bucket string) (usage, usage, error) {
+	var byOwner, byBucket usage
+	err := m.db.View(func(tx *bolt.Tx) error {
+		var err error
+		byOwner, byBucket, err = getUsage(tx, owner, bucket)
+		return err
+	})
+	return byOwner, byBucket, err
+}
+
+// Функция для чтения счётчиков владельца и бакета в транзакции
+func getUsage(tx *bolt.Tx, owner, bucket string) (usage, usage, error) {
+	var byOwner, byBucket usage
+	counters := tx.Bucket(metadataUsageBucket)
+	if len(owner) > 0 {
+		if _, err := getRecord(counters, ownerUsageKey(owner), &byOwner); err != nil {
+			return usage{}, usage{}, err
+		}
+	}
+	if _, err := getRecord(counters, bucketUsageKey(bucket), &byBucket); err != nil {
+		return usage{}, usage{}, err
+	}
+	return byOwner, byBucket, nil
+}
+
+// Функция для учёта файла md в счётчиках его владельца и бакета
+// и в сводных счётчиках: sign равен 1 при добавлении файла и -1 при его удалении
+func addUsage(tx *bolt.Tx, md *fileMetadata, sign int64) error {
+	delta := usage{Bytes: sign * md.logicalSize(), Objects: sign}
+	if len(md.Owner) > 0 {
+		if err := addUsageCounter(tx, ownerUsageKey(md.Owner), delta); err != nil {
+			return err
+		}
+	}
+	if err := addUsageCounter(tx, bucketUsageKey(md.bucket()), delta); err != nil {
+		return err
+	}
+
+	totals := storageTotals{Versions: sign * int64(len(md.Versions)), LogicalBytes: delta.Bytes}
+	if md.deleted() {
+		totals.DeletedFiles = sign
+	} else {
+		totals.Files = sign
+	}
+	return addTotals(tx, totals)
+}
+
+// Функция для изменения счётчика на delta; нулевой счётчик удаляется
+func addUsageCounter(tx *bolt.Tx, key string, delta usage) error {
+	counters := tx.Bucket(metadataUsageBucket)
+
+	var u usage
+	if _, err := getRecord(counters, key, &u); err != nil {
+		return err
+	}
+	u.Bytes += delta.Bytes
+	u.Objects += delta.Objects
+	if u.Bytes == 0 && u.Objects == 0 {
+		return counters.Delete([]byte(key))
+	}
+	return putRecord(counters, key, &u)
+}
+
+// Функция для создания счётчиков занятого места и сводных счётчиков.
+// При первом запуске после их появления счётчики заполняются по уже
+// записанным файлам, блобам и фрагментам
+func ensureUsageCounters(tx *bolt.Tx) error {
+	if counters := tx.Bucket(metadataUsageBucket); counters != nil {
+		if counters.Get([]byte(storageTotalsKey)) != nil {
+			return nil
+		}
+		if err := tx.DeleteBucket(metadataUsageBucket); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.CreateBucket(metadataUsageBucket); err != nil {
+		return err
+	}
+
+	var totals storageTotals
+	totals.Blobs = int64(tx.Bucket(metadataBlobsBucket).Stats().KeyN)
+	err := tx.Bucket(metadataChunksBucket).ForEach(func(k, raw []byte) error {
+		var rec chunkRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return err
+		}
+		totals.Chunks++
+		totals.StoredBytes += rec.Size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := addTotals(tx, totals); err != nil {
+		return err
+	}
+
+	return tx.Bucket(metadataFilesBucket).ForEach(func(k, raw []byte) error {
+		md := &fileMetadata{}
+		if err := json.Unmarshal(raw, md); err != nil {
+			return err
+		}
+		return addUsage(tx, md, 1)
+	})
+}
+
+// Метод для изменения метаданных файла, как Update, с проверкой квот
+// владельца и бакета b в той же транзакции: если файл вырастет сверх
+// жёсткой квоты, изменение не записывается. Возвращает предупреждение
+// о превышении мягкой квоты
+func (m *metadataStore) updateWithinQuota(id string, quotas *quotaConfig, b *bucketRecord, fn func(md *fileMetadata) (*fileMetadata, error)) (*fileMetadata, string, error) {
+	var result *fileMetadata
+	var warning string
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		md, err := getMetadata(tx, id)
+		if err != nil && !errors.Is(err, errMetadataNotFound) {
+			return err
+		}
+		// fn изменяет метаданные на месте, поэтому прежний размер
+		// запоминается заранее
+		var before usage
+		if md != nil {
+			before = usage{Bytes: md.logicalSize(), Objects: 1}
+		}
+
+		result, err = fn(md)
+		if err != nil {
+			return err
+		}
+		byOwner, byBucket, err := getUsage(tx, result.Owner, b.Name)
+		if err != nil {
+			return err
+		}
+		warning, err = quotas.check(result.Owner, byOwner, b, byBucket, result.logicalSize()-before.Bytes, 1-before.Objects)
+		if err != nil {
+			return err
+		}
+		return putMetadata(tx, result)
+	})
+	return result, warning, err
+}
+
+// Метод для предварительной проверки квот владельца owner и бакета b,
+// чтобы не сохранять содержимое, которое всё равно не поместится.
+// Окончательно квоты проверяются при записи метаданных файла
+func (s *server) checkQuota(owner string, b *bucketRecord, bytes, objects int64) error {
+	if bytes <= 0 && objects <= 0 {
+		return nil
+	}
+
+	byOwner, byBucket, err := s.meta.usage(owner, b.Name)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Failed to read usage: %v", err)
+	}
+	_, err = s.quotas.check(owner, byOwner, b, byBucket, bytes, objects)
+	return err
+}
+
+// Функция для получения владельца нового файла - пользователя,
+// выполняющего запрос
+func callerSubject(ctx context.Context) string {
+	if caller, ok := identityFromContext(ctx); ok {
+		return caller.Subject
+	}
+	return ""
+}
+
+// Функция для расчёта, на сколько байт вырастет файл при замене его
+// содержимого на size байт: без версионирования прежнее содержимое освобождается
+func replaceGrowth(b *bucketRecord, md *fileMetadata, size int64) int64 {
+	if b.Settings.DisableVersioning {
+		return size - md.Size
+	}
+	return size
+}
+
+// Метод для получения занятого места и квот пользователя и бакета
+func (s *server) GetUsage(ctx context.Context, req *pb.GetUsageRequest) (*pb.GetUsageResponse, error) {
+	b, err := s.lookupBucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := req.Owner
+	if len(owner) == 0 {
+		owner = callerSubject(ctx)
+	} else if owner != callerSubject(ctx) {
+		if err := checkAdmin(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	byOwner, byBucket, err := s.meta.usage(owner, b.Name)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to read usage: %v", err)
+	}
+
+	resp := &pb.GetUsageResponse{
+		Owner:  owner,
+		Bucket: b.Name,
+		BucketUsage: &pb.Usage{
+			Bytes:   byBucket.Bytes,
+			Objects: byBucket.Objects,
+			Quota:   b.Settings.Quota.proto(),
+		},
+	}
+	if len(owner) > 0 {
+		resp.UserUsage = &pb.Usage{
+			Bytes:   byOwner.Bytes,
+			Objects: byOwner.Objects,
+			Quota:   s.quotas.forUser(owner).proto(),
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Функция для загрузки файла через возобновляемую загрузку
+func uploadFile(t *testing.T, s *server, ctx context.Context, req *pb.BeginUploadRequest, data []byte) (*pb.CommitUploadResponse, error) {
+	t.Helper()
+	req.Size = int64(len(data))
+	begin, err := s.BeginUpload(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.UploadPart(ctx, &pb.UploadPartRequest{UploadId: begin.UploadId, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	return s.CommitUpload(ctx, &pb.CommitUploadRequest{UploadId: begin.UploadId, Sha256: sha256Hex(data)})
+}
+
+// Функция для проверки места, занятого выполняющим запрос пользователем и бакетом
+func checkUsage(t *testing.T, s *server, ctx context.Context, step, bucket string, user, inBucket usage) {
+	t.Helper()
+	resp, err := s.GetUsage(ctx, &pb.GetUsageRequest{Bucket: bucket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := usage{Bytes: resp.UserUsage.GetBytes(), Objects: resp.UserUsage.GetObjects()}
+	if got != user {
+		t.Errorf("%s: user usage = %+v, want %+v", step, got, user)
+	}
+	got = usage{Bytes: resp.BucketUsage.GetBytes(), Objects: resp.BucketUsage.GetObjects()}
+	if got != inBucket {
+		t.Errorf("%s: usage of bucket %q = %+v, want %+v", step, bucket, got, inBucket)
+	}
+	checkStats(t, s, step)
+}
+
+// Функция для проверки отказа из-за квоты
+func checkExhausted(t *testing.T, what string, err error) {
+	t.Helper()
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("%s: %v, want ResourceExhausted", what, err)
+	}
+}
+
+func TestQuotaRejectsWrites(t *testing.T) {
+	s := newTestServer(t)
+	uploads, err := newUploadManager(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.uploads = uploads
+	s.quotas = &quotaConfig{Users: map[string]quota{"alice": {HardBytes: 1000, SoftBytes: 800}}}
+	alice := asUser("alice")
+
+	first, err := s.CreateFile(alice, &pb.CreateFileRequest{File: randomContent(30, 600)})
+	if err != nil || len(first.QuotaWarning) > 0 {
+		t.Fatalf("create within the quota: %v, warning %q", err, first.GetQuotaWarning())
+	}
+	second, err := s.CreateFile(alice, &pb.CreateFileRequest{File: randomContent(31, 300)})
+	if err != nil || len(second.QuotaWarning) == 0 {
+		t.Fatalf("create over the soft quota: %v, warning %q, want a warning", err, second.GetQuotaWarning())
+	}
+	used := usage{Bytes: 900, Objects: 2}
+	checkUsage(t, s, alice, "before the hard quota", "", used, used)
+
+	extra := randomContent(32, 200)
+	_, err = s.CreateFile(alice, &pb.CreateFileRequest{File: extra})
+	checkExhausted(t, "CreateFile", err)
+	// Прежнее содержимое остаётся версией, поэтому обновление тоже занимает место
+	_, err = s.UpdateFile(alice, &pb.UpdateFileRequest{Id: first.Id, File: extra})
+	checkExhausted(t, "UpdateFile", err)
+	_, err = uploadFile(t, s, alice, &pb.BeginUploadRequest{}, extra)
+	checkExhausted(t, "CommitUpload of a new file", err)
+	_, err = uploadFile(t, s, alice, &pb.BeginUploadRequest{Id: first.Id}, extra)
+	checkExhausted(t, "CommitUpload replacing a file", err)
+
+	got, err := s.ReadFile(alice, &pb.ReadFileRequest{Id: first.Id})
+	if err != nil || sha256Hex(got.File) != sha256Hex(randomContent(30, 600)) {
+		t.Errorf("file after rejected updates: %v, want the original content", err)
+	}
+	checkUsage(t, s, alice, "after rejected writes", "", used, used)
+
+	// Квота одного пользователя не ограничивает других
+	if _, err := s.CreateFile(asUser("bob"), &pb.CreateFileRequest{File: extra}); err != nil {
+		t.Errorf("create by a user without a quota: %v", err)
+	}
+}
+
+func TestBucketQuota(t *testing.T) {
+	s := newTestServer(t)
+	alice := asUser("alice")
+	_, err := s.CreateBucket(alice, &pb.CreateBucketRequest{
+		Name: "flat",
+		Settings: &pb.BucketSettings{
+			Versioning: pb.Versioning_VERSIONING_DISABLED,
+			Quota:      &pb.Quota{HardBytes: 1000, HardObjects: 2},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := s.CreateFile(alice, &pb.CreateFileRequest{Bucket: "flat", File: randomContent(33, 900)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Без версий при замене растёт только разница размеров
+	if _, err := s.UpdateFile(alice, &pb.UpdateFileRequest{Bucket: "flat", Id: f.Id, File: randomContent(34, 1000)}); err != nil {
+		t.Errorf("update up to the quota: %v", err)
+	}
+	_, err = s.UpdateFile(alice, &pb.UpdateFileRequest{Bucket: "flat", Id: f.Id, File: randomContent(35, 1001)})
+	checkExhausted(t, "UpdateFile over the bucket quota", err)
+	if _, err := s.UpdateFile(alice, &pb.UpdateFileRequest{Bucket: "flat", Id: f.Id, File: randomContent(36, 10)}); err != nil {
+		t.Errorf("update shrinking the file: %v", err)
+	}
+
+	// Квота на число файлов действует и для администраторов
+	if _, err := s.CreateFile(alice, &pb.CreateFileRequest{Bucket: "flat", File: []byte("second")}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateFile(asUser("root", adminRole), &pb.CreateFileRequest{Bucket: "flat", File: []byte("third")})
+	checkExhausted(t, "CreateFile over the file quota", err)
+	checkUsage(t, s, alice, "bucket quota", "flat", usage{Bytes: 16, Objects: 2}, usage{Bytes: 16, Objects: 2})
+}
+
+func TestUsageCounters(t *testing.T) {
+	s := newTestServer(t)
+	alice := asUser("alice")
+	if _, err := s.CreateBucket(alice, &pb.CreateBucketRequest{Name: "other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := s.CreateFile(alice, &pb.CreateFileRequest{File: randomContent(40, 100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, alice, "create", "", usage{100, 1}, usage{100, 1})
+
+	if _, err := s.UpdateFile(alice, &pb.UpdateFileRequest{Id: a.Id, File: randomContent(41, 50)}); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, alice, "update", "", usage{150, 1}, usage{150, 1})
+
+	// Файлы другого бакета учитываются у владельца, но не в этом бакете
+	if _, err := s.CreateFile(alice, &pb.CreateFileRequest{Bucket: "other", File: randomContent(42, 10)}); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, alice, "create in another bucket", "", usage{160, 2}, usage{150, 1})
+	checkUsage(t, s, alice, "create in another bucket", "other", usage{160, 2}, usage{10, 1})
+
+	b, err := s.CreateFile(alice, &pb.CreateFileRequest{File: randomContent(43, 30)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, alice, "second create", "", usage{190, 3}, usage{180, 2})
+
+	// Файл в корзине занимает место, пока не удалён окончательно
+	if _, err := s.DeleteFile(alice, &pb.DeleteFileRequest{Id: b.Id}); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, alice, "delete", "", usage{190, 3}, usage{180, 2})
+	if _, err := s.UndeleteFile(alice, &pb.UndeleteFileRequest{Id: b.Id}); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, alice, "undelete", "", usage{190, 3}, usage{180, 2})
+	if _, err := s.DeleteFile(alice, &pb.DeleteFileRequest{Id: b.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PurgeFile(alice, &pb.PurgeFileRequest{Id: b.Id}); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, alice, "purge from trash", "", usage{160, 2}, usage{150, 1})
+
+	// Откат к версии добавляет версию: прежнее содержимое сохраняется
+	if _, err := s.RestoreVersion(alice, &pb.RestoreVersionRequest{Id: a.Id, Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, alice, "restore version", "", usage{260, 2}, usage{250, 1})
+
+	if _, err := s.PurgeFile(alice, &pb.PurgeFileRequest{Id: a.Id}); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, alice, "purge bypassing trash", "", usage{10, 1}, usage{})
+}
+
+func TestConcurrentCreatesWithinQuota(t *testing.T) {
+	s := newTestServer(t)
+	s.quotas = &quotaConfig{Default: quota{HardBytes: 500}}
+	alice := asUser("alice")
+
+	// Вместе запросы превышают квоту вчетверо, но каждый по отдельности
+	// проходит предварительную проверку
+	const writers = 20
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.CreateFile(alice, &pb.CreateFileRequest{File: randomContent(int64(50+i), 100)})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case status.Code(err) != codes.ResourceExhausted:
+			t.Errorf("concurrent create: %v", err)
+		}
+	}
+	if created != 5 {
+		t.Errorf("%d files created, want 5 within the quota of 500 bytes", created)
+	}
+	checkUsage(t, s, alice, "concurrent creates", "", usage{500, 5}, usage{500, 5})
+
+	// Содержимое отклонённых файлов не остаётся в хранилище
+	blobs, err := s.meta.listBlobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != created {
+		t.Errorf("%d blobs after concurrent creates, want %d", len(blobs), created)
+	}
+}
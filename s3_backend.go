@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Размер части при загрузке объекта неизвестного размера. Ограничивает
+// размер объекта значением 10000 частей, то есть примерно 160 ГиБ
+const s3PartSize = 16 << 20
+
+// Настройки S3-совместимого хранилища
+type s3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Insecure  bool
+	PathStyle bool
+}
+
+// Хранилище файлов в бакете S3-совместимого объектного хранилища
+type s3Backend struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// Функция для подключения к бакету. Если ключи не заданы, они берутся
+// из переменных окружения AWS/MinIO, файла ~/.aws/credentials или IAM
+func newS3Backend(ctx context.Context, cfg s3Config) (*s3Backend, error) {
+	if len(cfg.Endpoint) == 0 || len(cfg.Bucket) == 0 {
+		return nil, fmt.Errorf("s3 endpoint and bucket are required")
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	})
+	if len(cfg.AccessKey) > 0 {
+		creds = credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, "")
+	}
+
+	lookup := minio.BucketLookupAuto
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       !cfg.Insecure,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("s3 bucket %q does not exist", cfg.Bucket)
+	}
+
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if len(prefix) > 0 {
+		prefix += "/"
+	}
+
+	return &s3Backend{client: client, bucket: cfg.Bucket, prefix: prefix}, nil
+}
+
+// Ключ объекта в бакете
+func (b *s3Backend) key(name string) string {
+	return b.prefix + name
+}
+
+// Метод для сохранения объекта. Если размер известен (фрагменты передаются
+// как *bytes.Reader), объект загружается одним запросом, иначе - частями.
+// Потоковая подпись тела запроса отключена: её не поддерживают многие
+// S3-совместимые серверы и их заглушки для тестов
+func (b *s3Backend) Put(ctx context.Context, name string, r io.Reader) error {
+	size := int64(-1)
+	if sized, ok := r.(interface{ Len() int }); ok {
+		size = int64(sized.Len())
+	}
+	_, err := b.client.PutObject(ctx, b.bucket, b.key(name), r, size, minio.PutObjectOptions{
+		PartSize:             s3PartSize,
+		DisableContentSha256: true,
+	})
+	return err
+}
+
+// Метод для открытия объекта
+func (b *s3Backend) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.GetRange(ctx, name, 0, -1)
+}
+
+// Метод для открытия диапазона байт объекта
+func (b *s3Backend) GetRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	info, err := b.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > info.Size {
+		offset = info.Size
+	}
+	if length < 0 || offset+length > info.Size {
+		length = info.Size - offset
+	}
+	// Пустой диапазон S3 отклоняет, поэтому он обрабатывается отдельно
+	if length == 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, err
+	}
+
+	obj, err := b.client.GetObject(ctx, b.bucket, b.key(name), opts)
+	if err != nil {
+		return nil, b.convertError(name, err)
+	}
+	return obj, nil
+}
+
+// Метод для получения информации об объекте
+func (b *s3Backend) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	info, err := b.client.StatObject(ctx, b.bucket, b.key(name), minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, b.convertError(name, err)
+	}
+
+	// S3 не хранит время создания отдельно от времени изменения
+	return ObjectInfo{
+		Name:       name,
+		Size:       info.Size,
+		CreateTime: info.LastModified,
+		ModTime:    info.LastModified,
+	}, nil
+}
+
+// Метод для получения списка объектов
+func (b *s3Backend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for obj := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{
+		Prefix:    b.key(prefix),
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, ObjectInfo{
+			Name:       strings.TrimPrefix(obj.Key, b.prefix),
+			Size:       obj.Size,
+			CreateTime: obj.LastModified,
+			ModTime:    obj.LastModified,
+		})
+	}
+
+	return objects, nil
+}
+
+// Метод для удаления объекта. S3 не сообщает об удалении отсутствующего
+// объекта, поэтому его наличие проверяется заранее
+func (b *s3Backend) Delete(ctx context.Context, name string) error {
+	if _, err := b.Stat(ctx, name); err != nil {
+		return err
+	}
+	return b.client.RemoveObject(ctx, b.bucket, b.key(name), minio.RemoveObjectOptions{})
+}
+
+// Метод для преобразования ошибки S3 "нет такого ключа" в ErrObjectNotFound
+func (b *s3Backend) convertError(name string, err error) error {
+	resp := minio.ToErrorResponse(err)
+	if resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound {
+		return notFound(name)
+	}
+	return err
+}
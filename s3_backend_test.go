@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Заглушка S3 с адресацией бакета в пути: хранит объекты одного
+// бакета в памяти и считает запросы по методам
+type fakeS3 struct {
+	mu       sync.Mutex
+	bucket   string
+	objects  map[string][]byte
+	requests map[string]int
+	// Заголовок Content-Length последнего запроса PUT
+	putLength int64
+}
+
+// Функция для запуска заглушки S3 и подключения к ней хранилища
+func newFakeS3(t *testing.T, prefix string) (*fakeS3, *s3Backend) {
+	f := &fakeS3{bucket: "files", objects: make(map[string][]byte), requests: make(map[string]int)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	b, err := newS3Backend(context.Background(), s3Config{
+		Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+		Region:    "us-east-1",
+		Bucket:    f.bucket,
+		Prefix:    prefix,
+		AccessKey: "test",
+		SecretKey: "testsecret",
+		Insecure:  true,
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, b
+}
+
+// Метод для получения числа запросов с методом method
+func (f *fakeS3) count(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[method]
+}
+
+// Метод для обработки запроса к заглушке
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.Method]++
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if len(key) == 0 {
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+			f.list(w, r.URL.Query().Get("prefix"))
+		default:
+			s3Error(w, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+
+	data, ok := f.objects[key]
+	switch r.Method {
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = body
+		f.putLength = r.ContentLength
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead:
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		objectHeaders(w, int64(len(data)))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			objectHeaders(w, int64(len(data)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(data)
+			return
+		}
+		if end >= len(data) {
+			end = len(data) - 1
+		}
+		objectHeaders(w, int64(end-start+1))
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[start : end+1])
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// Метод для ответа на запрос списка объектов ListObjectsV2
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key          string
+		Size         int64
+		LastModified string
+		ETag         string
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []content
+	}{Name: f.bucket, Prefix: prefix}
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			Size:         int64(len(f.objects[key])),
+			LastModified: time.Now().UTC().Format(time.RFC3339),
+			ETag:         `"etag"`,
+		})
+	}
+	result.KeyCount = len(keys)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// Функция для заголовков ответа с содержимым объекта
+func objectHeaders(w http.ResponseWriter, size int64) {
+	w.Header().Set("Content-Length", fmt.Sprint(size))
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	w.Header().Set("ETag", `"etag"`)
+}
+
+// Функция для ответа ошибкой S3
+func s3Error(w http.ResponseWriter, code int, s3Code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", s3Code, s3Code)
+}
+
+func TestS3PutKnownSize(t *testing.T) {
+	f, b := newFakeS3(t, "")
+	data := bytes.Repeat([]byte("chunk"), 1000)
+
+	if err := b.Put(context.Background(), "chunks/abc", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.count(http.MethodPut); n != 1 {
+		t.Errorf("PUT requests = %d, want 1", n)
+	}
+	if n := f.count(http.MethodPost); n != 0 {
+		t.Errorf("POST requests = %d, want 0: object of known size must not use multipart upload", n)
+	}
+	if f.putLength != int64(len(data)) {
+		t.Errorf("Content-Length = %d, want %d", f.putLength, len(data))
+	}
+	if got := f.objects["chunks/abc"]; !bytes.Equal(got, data) {
+		t.Errorf("stored %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestS3GetRange(t *testing.T) {
+	f, b := newFakeS3(t, "store")
+	f.objects["store/range.bin"] = []byte("0123456789")
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{0, 4, "0123"},
+		{3, 4, "3456"},
+		{7, 100, "789"},
+		{10, -1, ""},
+		{12, 5, ""},
+	}
+	for _, tt := range tests {
+		if got := readObject(t, b, "range.bin", tt.offset, tt.length); string(got) != tt.want {
+			t.Errorf("GetRange(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestS3NotFound(t *testing.T) {
+	_, b := newFakeS3(t, "")
+	ctx := context.Background()
+
+	if _, err := b.Get(ctx, "missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Get: %v, want ErrObjectNotFound", err)
+	}
+	if _, err := b.Stat(ctx, "missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Stat: %v, want ErrObjectNotFound", err)
+	}
+	if err := b.Delete(ctx, "missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Delete: %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestS3ListAndDelete(t *testing.T) {
+	f, b := newFakeS3(t, "/store/")
+	ctx := context.Background()
+	for _, name := range []string{"a.txt", "chunks/aa", "chunks/ab"} {
+		if err := b.Put(ctx, name, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := f.objects["store/a.txt"]; !ok {
+		t.Fatalf("object keys %v have no prefix store/", f.objects)
+	}
+
+	objects, err := b.List(ctx, "chunks/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, obj := range objects {
+		names = append(names, obj.Name)
+	}
+	if strings.Join(names, ",") != "chunks/aa,chunks/ab" {
+		t.Errorf("List(chunks/) = %v", names)
+	}
+
+	if err := b.Delete(ctx, "chunks/aa"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Stat(ctx, "chunks/aa"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Stat after delete: %v, want ErrObjectNotFound", err)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Имя бакета базы с найденными повреждёнными фрагментами
+var metadataCorruptedBucket = []byte("corrupted")
+
+// Ключ времени окончания последней проверки целостности
+var lastScrubKey = []byte("last_scrub")
+
+// Префикс имён объектов изолированных повреждённых фрагментов
+const quarantinePrefix = "quarantine/"
+
+// Ошибка чтения содержимого, в котором есть повреждённые фрагменты
+var errContentCorrupted = errors.New("content is corrupted")
+
+// Учёт повреждённого фрагмента
+type corruptedChunk struct {
+	Size        int64     `json:"size"`
+	Error       string    `json:"error"`
+	DetectTime  time.Time `json:"detect_time"`
+	Quarantined bool      `json:"quarantined,omitempty"`
+}
+
+// Настройки проверки целостности хранилища
+type scrubConfig struct {
+	Interval time.Duration
+	// Наибольшая скорость чтения, байт в секунду; 0 - без ограничения
+	Rate int64
+	// Переносить ли повреждённые фрагменты в карантин
+	Quarantine bool
+}
+
+// Метод для учёта повреждённого фрагмента
+func (m *metadataStore) markCorrupted(hash string, rec corruptedChunk) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		return putRecord(tx.Bucket(metadataCorruptedBucket), hash, &rec)
+	})
+}
+
+// Метод для снятия отметки о повреждении фрагмента. Возвращает
+// удалённый учёт или nil, если фрагмент не был повреждён
+func (m *metadataStore) clearCorrupted(hash string) (*corruptedChunk, error) {
+	var rec *corruptedChunk
+	err := m.db.Update(func(tx *bolt.Tx) error {
+		corrupted := tx.Bucket(metadataCorruptedBucket)
+
+		var r corruptedChunk
+		ok, err := getRecord(corrupted, hash, &r)
+		if err != nil || !ok {
+			return err
+		}
+		rec = &r
+		return corrupted.Delete([]byte(hash))
+	})
+	return rec, err
+}
+
+// Метод для проверки, есть ли среди фрагментов повреждённые
+func (m *metadataStore) hasCorrupted(chunks []chunkRef) (bool, error) {
+	var found bool
+	err := m.db.View(func(tx *bolt.Tx) error {
+		corrupted := tx.Bucket(metadataCorruptedBucket)
+		for _, ref := range chunks {
+			if corrupted.Get([]byte(ref.Hash)) != nil {
+				found = true
+				break
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// Метод для получения учёта всех повреждённых фрагментов
+func (m *metadataStore) listCorrupted() (map[string]corruptedChunk, error) {
+	chunks := make(map[string]corruptedChunk)
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(metadataCorruptedBucket).ForEach(func(k, raw []byte) error {
+			var rec corruptedChunk
+			if err := json.Unmarshal(raw, &rec); err != nil {
+				return err
+			}
+			chunks[string(k)] = rec
+			return nil
+		})
+	})
+	return chunks, err
+}
+
+// Метод для проверки, учтён ли фрагмент
+func (m *metadataStore) hasChunk(hash string) (bool, error) {
+	var ok bool
+	err := m.db.View(func(tx *bolt.Tx) error {
+		ok = tx.Bucket(metadataChunksBucket).Get([]byte(hash)) != nil
+		return nil
+	})
+	return ok, err
+}
+
+// Ограничитель скорости чтения: запись в него приостанавливается,
+// пока средняя скорость выше заданной
+type throttle struct {
+	ctx   context.Context
+	rate  int64
+	start time.Time
+	bytes int64
+}
+
+// Функция для создания ограничителя со скоростью rate байт в секунду
+func newThrottle(ctx context.Context, rate int64) *throttle {
+	return &throttle{ctx: ctx, rate: rate, start: time.Now()}
+}
+
+// Метод для учёта прочитанных данных
+func (t *throttle) Write(p []byte) (int, error) {
+	t.bytes += int64(len(p))
+	if t.rate <= 0 {
+		return len(p), nil
+	}
+
+	due := time.Duration(float64(t.bytes) / float64(t.rate) * float64(time.Second))
+	if wait := due - time.Since(t.start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-t.ctx.Done():
+			return 0, t.ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return len(p), nil
+}
+
+// Метод для получения времени окончания последней проверки целостности;
+// нулевое время, если хранилище ещё не проверялось
+func (m *metadataStore) lastScrub() (time.Time, error) {
+	var last time.Time
+	err := m.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(metadataStateBucket).Get(lastScrubKey)
+		if raw == nil {
+			return nil
+		}
+		return last.UnmarshalText(raw)
+	})
+	return last, err
+}
+
+// Метод для сохранения времени окончания проверки целостности
+func (m *metadataStore) setLastScrub(last time.Time) error {
+	raw, err := last.MarshalText()
+	if err != nil {
+		return err
+	}
+	return m.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metadataStateBucket).Put(lastScrubKey, raw)
+	})
+}
+
+// Метод для периодической проверки целостности хранилища. Время последней
+// проверки хранится в каталоге, поэтому перезапуск сервера не откладывает
+// проверку, а просроченная проверка начинается сразу при запуске
+func (s *server) scrub(ctx context.Context, cfg scrubConfig) {
+	next := time.Now()
+	if last, err := s.meta.lastScrub(); err != nil {
+		log.Printf("Failed to read last scrub time: %v", err)
+	} else {
+		next = last.Add(cfg.Interval)
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := s.scrubChunks(ctx, cfg); err != nil {
+			log.Printf("Failed to scrub storage: %v", err)
+		} else if err := s.meta.setLastScrub(time.Now()); err != nil {
+			log.Printf("Failed to save last scrub time: %v", err)
+		}
+		next = time.Now().Add(cfg.Interval)
+	}
+}
+
+// Метод для проверки всех фрагментов: содержимое каждого заново
+// хешируется и сравнивается с контрольной суммой, под которой он хранится
+func (s *server) scrubChunks(ctx context.Context, cfg scrubConfig) error {
+	chunks, err := s.meta.listChunks()
+	if err != nil {
+		return err
+	}
+	corrupted, err := s.meta.listCorrupted()
+	if err != nil {
+		return err
+	}
+
+	t := newThrottle(ctx, cfg.Rate)
+	checked, found := 0, 0
+	for hash, rec := range chunks {
+		if _, ok := corrupted[hash]; ok {
+			continue
+		}
+		bad, err := s.scrubChunk(ctx, hash, rec.Size, t, cfg.Quarantine)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("Failed to check chunk %s: %v", hash, err)
+			continue
+		}
+		checked++
+		if bad {
+			found++
+		}
+	}
+	log.Printf("Scrub finished: %d chunks checked, %d corrupted", checked, found)
+
+	return nil
+}
+
+// Метод для проверки фрагмента. Возвращает, оказался ли он повреждён
+func (s *server) scrubChunk(ctx context.Context, hash string, size int64, t *throttle, quarantine bool) (bool, error) {
+	name := chunkObjectName(hash)
+	unlock := s.locks.Lock(name)
+	defer unlock()
+
+	// Фрагмент могли освободить после получения списка
+	ok, err := s.meta.hasChunk(hash)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	reason, err := s.verifyChunk(ctx, name, hash, size, t)
+	if err != nil || len(reason) == 0 {
+		return false, err
+	}
+
+	rec := corruptedChunk{Size: size, Error: reason, DetectTime: time.Now()}
+	if quarantine {
+		rec.Quarantined, err = s.quarantineChunk(ctx, name, hash)
+		if err != nil {
+			log.Printf("Failed to quarantine chunk %s: %v", hash, err)
+		}
+	}
+	log.Printf("Chunk %s is corrupted: %s", hash, reason)
+
+	return true, s.meta.markCorrupted(hash, rec)
+}
+
+// Метод для сверки содержимого фрагмента с его размером и контрольной
+// суммой. Возвращает описание повреждения или пустую строку
+func (s *server) verifyChunk(ctx context.Context, name, hash string, size int64, t *throttle) (string, error) {
+	r, err := s.backend.Get(ctx, name)
+	if errors.Is(err, ErrObjectNotFound) {
+		return "object not found", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(h, t), r)
+	if err != nil {
+		return "", err
+	}
+	if n != size {
+		return fmt.Sprintf("size is %d, expected %d", n, size), nil
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != hash {
+		return fmt.Sprintf("checksum is %s", sum), nil
+	}
+	return "", nil
+}
+
+// Метод для переноса повреждённого фрагмента в карантин. Возвращает
+// false, если переносить нечего: объекта фрагмента нет в хранилище
+func (s *server) quarantineChunk(ctx context.Context, name, hash string) (bool, error) {
+	r, err := s.backend.Get(ctx, name)
+	if errors.Is(err, ErrObjectNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	err = s.backend.Put(ctx, quarantinePrefix+hash, r)
+	r.Close()
+	if err != nil {
+		return false, err
+	}
+	return true, s.backend.Delete(ctx, name)
+}
+
+// Метод для снятия отметки о повреждении фрагмента, который записан
+// заново или больше не нужен. Его копия в карантине удаляется
+func (s *server) forgetCorrupted(ctx context.Context, hash string) {
+	rec, err := s.meta.clearCorrupted(hash)
+	if err != nil {
+		log.Printf("Failed to clear corruption mark of chunk %s: %v", hash, err)
+		return
+	}
+	if rec != nil && rec.Quarantined {
+		if err := s.backend.Delete(ctx, quarantinePrefix+hash); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			log.Printf("Failed to delete quarantined chunk %s: %v", hash, err)
+		}
+	}
+}
+
+// Метод для получения списка повреждённых фрагментов вместе с файлами
+// и версиями, содержимое которых их включает
+func (s *server) ListCorruptedChunks(ctx context.Context, req *pb.ListCorruptedChunksRequest) (*pb.ListCorruptedChunksResponse, error) {
+	if err := checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	corrupted, err := s.meta.listCorrupted()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to read corrupted chunks: %v", err)
+	}
+
+	resp := &pb.ListCorruptedChunksResponse{}
+	if len(corrupted) == 0 {
+		return resp, nil
+	}
+
+	files, err := s.meta.List()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to read metadata: %v", err)
+	}
+	blobs, err := s.meta.listBlobs()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to read blobs: %v", err)
+	}
+
+	owners := make(map[string][]*pb.ChunkOwner)
+	addOwner := func(md *fileMetadata, version int64, checksum string) {
+		seen := make(map[string]bool)
+		for _, ref := range blobs[checksum].Chunks {
+			if _, ok := corrupted[ref.Hash]; ok && !seen[ref.Hash] {
+				seen[ref.Hash] = true
+				owners[ref.Hash] = append(owners[ref.Hash], &pb.ChunkOwner{Id: md.ID, Bucket: md.bucket(), Extension: md.Extension, Version: version})
+			}
+		}
+	}
+	for _, md := range files {
+		addOwner(md, md.currentVersion(), md.SHA256)
+		for _, v := range md.Versions {
+			addOwner(md, v.Version, v.SHA256)
+		}
+	}
+
+	for hash, rec := range corrupted {
+		resp.Chunks = append(resp.Chunks, &pb.CorruptedChunk{
+			Hash:        hash,
+			Size:        rec.Size,
+			Error:       rec.Error,
+			DetectTime:  timestamppb.New(rec.DetectTime),
+			Quarantined: rec.Quarantined,
+			Files:       owners[hash],
+		})
+	}
+	sort.Slice(resp.Chunks, func(i, j int) bool {
+		return resp.Chunks[i].DetectTime.AsTime().After(resp.Chunks[j].DetectTime.AsTime())
+	})
+
+	return resp, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Функция для ожидания условия не дольше нескольких секунд
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScrubSchedule(t *testing.T) {
+	ctx := context.Background()
+	cfg := scrubConfig{Interval: time.Hour}
+
+	tests := []struct {
+		name    string
+		last    time.Duration
+		overdue bool
+	}{
+		{name: "never scrubbed", overdue: true},
+		{name: "overdue", last: 2 * time.Hour, overdue: true},
+		{name: "recent", last: time.Minute, overdue: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			f, err := s.CreateFile(ctx, &pb.CreateFileRequest{File: []byte("content")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			md, err := s.meta.Get(f.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blob, err := s.meta.getBlob(md.SHA256)
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := chunkObjectName(blob.Chunks[0].Hash)
+			if err := s.backend.Put(ctx, name, strings.NewReader("damaged")); err != nil {
+				t.Fatal(err)
+			}
+			if tt.last > 0 {
+				if err := s.meta.setLastScrub(time.Now().Add(-tt.last)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before, err := s.meta.lastScrub()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			scrubCtx, cancel := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() {
+				s.scrub(scrubCtx, cfg)
+				close(done)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			corrupted := func() bool {
+				found, err := s.meta.hasCorrupted(blob.Chunks)
+				return err == nil && found
+			}
+			if !tt.overdue {
+				time.Sleep(100 * time.Millisecond)
+				if corrupted() {
+					t.Error("scrub ran before the interval passed")
+				}
+				return
+			}
+			waitFor(t, "the scrub at startup", func() bool {
+				last, err := s.meta.lastScrub()
+				return err == nil && last.After(before)
+			})
+			if !corrupted() {
+				t.Error("scrub at startup did not find the damaged chunk")
+			}
+		})
+	}
+}
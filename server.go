@@ -1,87 +1,627 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
+	"flag"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
-	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/NastyNobbo/go-file-storage/storage"
 	pb "github.com/NastyNobbo/go-file-storage/storage"
 )
 
-// Путь к хранилищу файлов
+// Путь к хранилищу файлов по умолчанию
 const storagePath = "./client/files"
 
+// Размер части файла при потоковой выгрузке: по умолчанию и максимальный
+const (
+	defaultChunkSize = 64 << 10
+	maxChunkSize     = 1 << 20
+)
+
+// Наибольший размер диапазона, читаемого ReadFile: ответ должен поместиться
+// в сообщение gRPC, которое по умолчанию не больше 4 МиБ
+const maxReadLength = 4<<20 - 4<<10
+
+// Размер страницы списка файлов и корзины: по умолчанию и максимальный
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
 // Встраиваем нереализованный интерфейс хранилища файлов
 type server struct {
 	storage.UnimplementedFileStorageServer
+	backend   Backend
+	meta      *metadataStore
+	uploads   *uploadManager
+	locks     *lockManager
+	retention versionRetention
+	quotas    *quotaConfig
 }
 
 // Метод для создания файла
 func (s *server) CreateFile(ctx context.Context, req *pb.CreateFileRequest) (*pb.CreateFileResponse, error) {
+	b, err := s.lookupBucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
 	fileID := generateFileID()
-	fileExt := req.Extension
+	fileExt := b.extension(req.Extension)
 
-	if len(fileExt) == 0 {
-		fileExt = ".txt"
+	if _, err := objectName(fileID, fileExt); err != nil {
+		return nil, err
 	}
-
-	if len(fileExt) > 1 && fileExt[0] != '.' {
-		fileExt = "." + fileExt
+	if err := b.checkSize(int64(len(req.File))); err != nil {
+		return nil, err
+	}
+	want, err := parseChecksums(req.Sha256, req.Crc32C)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkQuota(callerSubject(ctx), b, int64(len(req.File)), 1); err != nil {
+		return nil, err
 	}
 
-	filePath := filepath.Join(storagePath, fileID+fileExt)
-
-	err := ioutil.WriteFile(filePath, req.File, 0644)
+	sum, err := s.putBlob(ctx, bytes.NewReader(req.File))
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to create file: %v", err)
 	}
+	if err := s.verifyContent(ctx, sum, want); err != nil {
+		return nil, err
+	}
+	md, warning, err := s.recordFile(ctx, b.Name, fileID, fileExt, req.Name, sum.content(fileExt), nil)
+	if err != nil {
+		s.releaseBlob(ctx, sum.Checksum())
+		return nil, err
+	}
 
-	return &pb.CreateFileResponse{Id: fileID, Extension: fileExt}, nil
+	return &pb.CreateFileResponse{Id: fileID, Extension: fileExt, Etag: md.etag(), QuotaWarning: warning}, nil
 }
 
-// Метод для чтения файла
+// Метод для чтения файла целиком или заданного диапазона байт
 func (s *server) ReadFile(ctx context.Context, req *pb.ReadFileRequest) (*pb.ReadFileResponse, error) {
-	filePath := filepath.Join(storagePath, req.Id+req.Extension)
-	data, err := ioutil.ReadFile(filePath)
+	if req.Offset < 0 || req.Length < 0 {
+		return nil, status.Errorf(codes.OutOfRange, "Invalid range: offset %d, length %d", req.Offset, req.Length)
+	}
+
+	unlock := s.locks.RLock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupMetadata(ctx, req.Bucket, req.Id, req.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permRead); err != nil {
+		return nil, err
+	}
+	checksum, crc, size := md.SHA256, md.CRC32C, md.Size
+	version := md.currentVersion()
+	tag := md.etag()
+	if req.Version != 0 && req.Version != version {
+		v, ok := md.findVersion(req.Version)
+		if !ok {
+			return nil, status.Errorf(codes.NotFound, "Version %d of file %s not found", req.Version, md.ID)
+		}
+		checksum, crc, size = v.SHA256, v.CRC32C, v.Size
+		version = req.Version
+		tag = etag(v.Version, v.SHA256)
+	}
+
+	if req.Offset > size {
+		return nil, status.Errorf(codes.OutOfRange, "Offset %d is beyond end of file (size %d)", req.Offset, size)
+	}
+
+	// Диапазон, выходящий за конец файла, обрезается по его размеру
+	length := size - req.Offset
+	if req.Length > 0 && req.Length < length {
+		length = req.Length
+	}
+	if length > maxReadLength {
+		return nil, status.Errorf(codes.OutOfRange, "Range of %d bytes exceeds the ReadFile limit of %d bytes; use DownloadFile or read smaller ranges", length, maxReadLength)
+	}
+
+	r, err := s.openBlob(ctx, checksum, req.Offset, length)
 	if err != nil {
-		return nil, status.Errorf(codes.NotFound, "File not found: %v", err)
+		return nil, backendError(err, "Failed to read file")
+	}
+	defer r.Close()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, backendError(err, "Failed to read file")
 	}
 
-	return &pb.ReadFileResponse{File: data}, nil
+	return &pb.ReadFileResponse{
+		File:      data,
+		Size:      size,
+		Extension: md.Extension,
+		Version:   version,
+		Etag:      tag,
+		Sha256:    checksum,
+		Crc32C:    crc,
+	}, nil
 }
 
-// Метод для обновления файла
+// Метод для обновления существующего файла. Прежнее содержимое
+// сохраняется как предыдущая версия
 func (s *server) UpdateFile(ctx context.Context, req *pb.UpdateFileRequest) (*pb.UpdateFileResponse, error) {
-	filePath := filepath.Join(storagePath, req.Id+req.Extension)
-	err := ioutil.WriteFile(filePath, req.File, 0644)
+	unlock := s.locks.Lock(req.Id)
+	defer unlock()
+
+	md, b, err := s.lookupForUpdate(ctx, req.Bucket, req.Id, req.Extension, req.IfMatch, req.LockToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkSize(int64(len(req.File))); err != nil {
+		return nil, err
+	}
+	want, err := parseChecksums(req.Sha256, req.Crc32C)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkQuota(md.Owner, b, replaceGrowth(b, md, int64(len(req.File))), 0); err != nil {
+		return nil, err
+	}
+
+	sum, err := s.putBlob(ctx, bytes.NewReader(req.File))
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to update file: %v", err)
 	}
+	if err := s.verifyContent(ctx, sum, want); err != nil {
+		return nil, err
+	}
+	md, warning, err := s.replaceContent(ctx, b, md, sum.content(md.Extension))
+	if err != nil {
+		s.releaseBlob(ctx, sum.Checksum())
+		return nil, err
+	}
+
+	return &pb.UpdateFileResponse{Etag: md.etag(), QuotaWarning: warning}, nil
+}
+
+// Метод для получения файла, содержимое которого заменяется, и его бакета
+// с проверкой права на запись, блокировки и условия if_match
+func (s *server) lookupForUpdate(ctx context.Context, bucket, id, ext, ifMatch, lockToken string) (*fileMetadata, *bucketRecord, error) {
+	md, err := s.lookupMetadata(ctx, bucket, id, ext)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkAccess(ctx, md, permWrite); err != nil {
+		return nil, nil, err
+	}
+	if err := s.locks.checkLease(md.ID, lockToken); err != nil {
+		return nil, nil, err
+	}
+	if err := checkIfMatch(md, ifMatch); err != nil {
+		return nil, nil, err
+	}
+	b, err := s.lookupBucket(ctx, bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	return md, b, nil
+}
+
+// Метод для замены содержимого файла блобом sum, уже записанным в хранилище
+// без блокировки файла. Пока содержимое передавалось, файл могли изменить,
+// поэтому условия записи проверяются заново. При ошибке ссылка на блоб
+// освобождается
+func (s *server) commitReplacement(ctx context.Context, bucket, id, ext, ifMatch, lockToken string, sum *contentSummary) (*fileMetadata, string, error) {
+	unlock := s.locks.Lock(id)
+	defer unlock()
 
-	return &pb.UpdateFileResponse{}, nil
+	md, b, err := s.lookupForUpdate(ctx, bucket, id, ext, ifMatch, lockToken)
+	if err == nil {
+		err = b.checkSize(sum.size)
+	}
+	var warning string
+	if err == nil {
+		md, warning, err = s.replaceContent(ctx, b, md, sum.content(md.Extension))
+	}
+	if err != nil {
+		s.releaseBlob(ctx, sum.Checksum())
+		return nil, "", err
+	}
+	return md, warning, nil
 }
 
-// Метод для удаления файла
+// Метод для удаления файла: файл перемещается в корзину
 func (s *server) DeleteFile(ctx context.Context, req *pb.DeleteFileRequest) (*pb.DeleteFileResponse, error) {
-	filePath := filepath.Join(storagePath, req.Id+req.Extension)
+	unlock := s.locks.Lock(req.Id)
+	defer unlock()
 
-	err := os.Remove(filePath)
+	md, err := s.lookupMetadata(ctx, req.Bucket, req.Id, req.Extension)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to delete file: %v", err)
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permDelete); err != nil {
+		return nil, err
+	}
+	if err := s.locks.checkLease(md.ID, req.LockToken); err != nil {
+		return nil, err
+	}
+	if err := checkIfMatch(md, req.IfMatch); err != nil {
+		return nil, err
+	}
+
+	if err := s.moveToTrash(md); err != nil {
+		return nil, err
 	}
+	s.locks.dropLease(md.ID)
 
 	return &pb.DeleteFileResponse{}, nil
 }
 
+// Метод для потоковой загрузки файла: первое сообщение содержит метаданные,
+// остальные - части файла, которые сразу передаются в хранилище
+func (s *server) UploadFile(stream pb.FileStorage_UploadFileServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "Failed to receive file metadata: %v", err)
+	}
+	meta := first.GetMetadata()
+	if meta == nil {
+		return status.Error(codes.InvalidArgument, "First message must contain file metadata")
+	}
+	if meta.Size < 0 {
+		return status.Errorf(codes.InvalidArgument, "Invalid file size: %d", meta.Size)
+	}
+
+	// Если указан идентификатор, поток заменяет содержимое существующего файла
+	if len(meta.Id) > 0 {
+		return s.updateFromStream(stream, meta)
+	}
+
+	ctx := stream.Context()
+	b, err := s.lookupBucket(ctx, meta.Bucket)
+	if err != nil {
+		return err
+	}
+	if err := b.checkSize(meta.Size); err != nil {
+		return err
+	}
+	// Объявленный размер проверяется заранее, чтобы не принимать файл,
+	// который всё равно не поместится в квоту
+	if err := s.checkQuota(callerSubject(ctx), b, meta.Size, 1); err != nil {
+		return err
+	}
+
+	fileExt := meta.Extension
+	if len(fileExt) == 0 {
+		fileExt = filepath.Ext(meta.Name)
+	}
+	fileID := generateFileID()
+	fileExt = b.extension(fileExt)
+
+	if _, err := objectName(fileID, fileExt); err != nil {
+		return err
+	}
+	want, err := parseChecksums(meta.Sha256, meta.Crc32C)
+	if err != nil {
+		return err
+	}
+
+	r := &uploadStreamReader{stream: stream, size: meta.Size, bucket: b}
+	sum, err := s.putBlob(ctx, r)
+	if err != nil {
+		if r.err != nil {
+			return r.err
+		}
+		return status.Errorf(codes.Internal, "Failed to create file: %v", err)
+	}
+	if err := s.verifyContent(ctx, sum, want); err != nil {
+		return err
+	}
+	md, warning, err := s.recordFile(ctx, b.Name, fileID, fileExt, meta.Name, sum.content(fileExt), nil)
+	if err != nil {
+		s.releaseBlob(ctx, sum.Checksum())
+		return err
+	}
+
+	return stream.SendAndClose(&pb.UploadFileResponse{Id: fileID, Extension: fileExt, Etag: md.etag(), QuotaWarning: warning})
+}
+
+// Метод для замены содержимого существующего файла содержимым потока.
+// Файл блокируется только на время записи метаданных, чтобы медленная
+// передача не задерживала работу с ним
+func (s *server) updateFromStream(stream pb.FileStorage_UploadFileServer, meta *pb.UploadMetadata) error {
+	ctx := stream.Context()
+	// Условия записи проверяются заранее, чтобы не принимать файл напрасно
+	md, b, err := s.lookupForUpdate(ctx, meta.Bucket, meta.Id, meta.Extension, meta.IfMatch, meta.LockToken)
+	if err != nil {
+		return err
+	}
+	if err := b.checkSize(meta.Size); err != nil {
+		return err
+	}
+	if err := s.checkQuota(md.Owner, b, replaceGrowth(b, md, meta.Size), 0); err != nil {
+		return err
+	}
+	want, err := parseChecksums(meta.Sha256, meta.Crc32C)
+	if err != nil {
+		return err
+	}
+
+	r := &uploadStreamReader{stream: stream, size: meta.Size, bucket: b}
+	sum, err := s.putBlob(ctx, r)
+	if err != nil {
+		if r.err != nil {
+			return r.err
+		}
+		return status.Errorf(codes.Internal, "Failed to update file: %v", err)
+	}
+	if err := s.verifyContent(ctx, sum, want); err != nil {
+		return err
+	}
+	md, warning, err := s.commitReplacement(ctx, b.Name, md.ID, md.Extension, meta.IfMatch, meta.LockToken, sum)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(&pb.UploadFileResponse{Id: md.ID, Extension: md.Extension, Etag: md.etag(), QuotaWarning: warning})
+}
+
+// Читатель содержимого файла из потока UploadFile
+type uploadStreamReader struct {
+	stream pb.FileStorage_UploadFileServer
+	size   int64
+	read   int64
+	buf    []byte
+	// Бакет, ограничивающий размер файла
+	bucket *bucketRecord
+	// Ошибка gRPC, прервавшая чтение потока
+	err error
+}
+
+// Метод для чтения очередной порции данных из потока
+func (r *uploadStreamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg, err := r.stream.Recv()
+		if err == io.EOF {
+			if r.size > 0 && r.read != r.size {
+				r.err = status.Errorf(codes.InvalidArgument, "Received %d bytes, expected %d", r.read, r.size)
+				return 0, r.err
+			}
+			return 0, io.EOF
+		}
+		if err != nil {
+			r.err = status.Errorf(codes.Canceled, "Failed to receive file chunk: %v", err)
+			return 0, r.err
+		}
+		if msg.GetMetadata() != nil {
+			r.err = status.Error(codes.InvalidArgument, "Metadata may only be sent in the first message")
+			return 0, r.err
+		}
+
+		r.buf = msg.GetChunk()
+		if r.size > 0 && r.read+int64(len(r.buf)) > r.size {
+			r.err = status.Errorf(codes.InvalidArgument, "File is larger than declared size %d", r.size)
+			return 0, r.err
+		}
+		if err := r.bucket.checkSize(r.read + int64(len(r.buf))); err != nil {
+			r.err = err
+			return 0, r.err
+		}
+		r.read += int64(len(r.buf))
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Метод для потоковой выгрузки файла: сначала отправляется заголовок
+// с размером и контрольной суммой, затем файл частями
+func (s *server) DownloadFile(req *pb.DownloadFileRequest, stream pb.FileStorage_DownloadFileServer) error {
+	chunkSize := int(req.ChunkSize)
+	if chunkSize < 0 {
+		return status.Errorf(codes.InvalidArgument, "Invalid chunk size: %d", req.ChunkSize)
+	}
+	if chunkSize == 0 {
+		chunkSize = defaultChunkSize
+	}
+	if chunkSize > maxChunkSize {
+		chunkSize = maxChunkSize
+	}
+
+	ctx := stream.Context()
+
+	md, err := s.retainForDownload(ctx, req)
+	if err != nil {
+		return err
+	}
+	// Поток может прерваться, а фрагменты без ссылок должны быть удалены
+	defer s.releaseBlob(context.Background(), md.SHA256)
+
+	r, err := s.openBlob(ctx, md.SHA256, 0, -1)
+	if err != nil {
+		return backendError(err, "Failed to read file")
+	}
+	defer r.Close()
+
+	err = stream.Send(&pb.DownloadChunk{Data: &pb.DownloadChunk_Header{Header: &pb.DownloadHeader{
+		Size:      md.Size,
+		Extension: md.Extension,
+		Checksum:  md.SHA256,
+		Crc32C:    md.CRC32C,
+		Etag:      md.etag(),
+	}}})
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := stream.Send(&pb.DownloadChunk{Data: &pb.DownloadChunk_Chunk{Chunk: buf[:n]}}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "Failed to read file: %v", err)
+		}
+	}
+}
+
+// Метод для получения метаданных выгружаемого файла и взятия ссылки на его
+// содержимое. Файл блокируется только на время получения метаданных: ссылка
+// не даёт удалить содержимое, пока оно передаётся, а медленный клиент
+// не задерживает изменение и удаление файла
+func (s *server) retainForDownload(ctx context.Context, req *pb.DownloadFileRequest) (*fileMetadata, error) {
+	unlock := s.locks.RLock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupMetadata(ctx, req.Bucket, req.Id, req.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permRead); err != nil {
+		return nil, err
+	}
+	if err := s.retainBlob(ctx, md.SHA256); err != nil {
+		return nil, backendError(err, "Failed to read file")
+	}
+	return md, nil
+}
+
+// Метод для получения списка файлов с фильтрацией, сортировкой и постраничным
+// выводом. Файлы читаются по индексу в нужном порядке начиная с токена
+// страницы, поэтому страница не требует чтения всего каталога
+func (s *server) ListFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
+	size, err := pageSize(req.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	after, err := parsePageToken(req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	order, err := sortOrder(req.SortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := s.lookupBucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	filterExt := ""
+	if len(req.Extension) > 0 {
+		filterExt = normalizeExtension(req.Extension)
+	}
+
+	resp := &pb.ListFilesResponse{}
+	err = s.meta.scanIndex(b.Name, order, after, req.Descending, func(key []byte, md *fileMetadata) bool {
+		if !allowed(ctx, md, permRead) {
+			return true
+		}
+		if len(filterExt) > 0 && !strings.EqualFold(md.Extension, filterExt) {
+			return true
+		}
+		// Файл сверх страницы означает, что есть следующая страница
+		if len(resp.Files) == size {
+			resp.NextPageToken = pageToken(after)
+			return false
+		}
+
+		resp.Files = append(resp.Files, &pb.FileInfo{
+			Id:          md.ID,
+			Extension:   md.Extension,
+			Name:        md.Name,
+			Size:        md.Size,
+			ModTime:     timestamppb.New(md.UpdateTime),
+			ContentType: md.ContentType,
+		})
+		after = append(after[:0:0], key...)
+		return true
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to list files: %v", err)
+	}
+
+	return resp, nil
+}
+
+// Метод для получения метаданных файла без его содержимого
+func (s *server) StatFile(ctx context.Context, req *pb.StatFileRequest) (*pb.StatFileResponse, error) {
+	unlock := s.locks.RLock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupMetadata(ctx, req.Bucket, req.Id, req.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permRead); err != nil {
+		return nil, err
+	}
+
+	return &pb.StatFileResponse{
+		Id:          md.ID,
+		Extension:   md.Extension,
+		Size:        md.Size,
+		CreateTime:  timestamppb.New(md.CreateTime),
+		ModTime:     timestamppb.New(md.UpdateTime),
+		ContentType: md.ContentType,
+		Checksum:    md.SHA256,
+		Etag:        md.etag(),
+		Crc32C:      md.CRC32C,
+	}, nil
+}
+
+// Функция для получения имени объекта в хранилище. Имя не должно выходить
+// за пределы хранилища или совпадать со служебными данными
+func objectName(id, ext string) (string, error) {
+	name := id + ext
+	if len(id) == 0 || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", status.Errorf(codes.InvalidArgument, "Invalid file id: %q", name)
+	}
+	return name, nil
+}
+
+// Функция для преобразования ошибки хранилища в статус gRPC
+func backendError(err error, msg string) error {
+	if errors.Is(err, ErrObjectNotFound) {
+		return status.Errorf(codes.NotFound, "File not found: %v", err)
+	}
+	if errors.Is(err, errContentCorrupted) {
+		return status.Errorf(codes.DataLoss, "File is damaged: %v", err)
+	}
+	return status.Errorf(codes.Internal, "%s: %v", msg, err)
+}
+
+// Функция для приведения расширения к виду ".ext" (по умолчанию ".txt")
+func normalizeExtension(fileExt string) string {
+	if len(fileExt) == 0 {
+		return ".txt"
+	}
+
+	if len(fileExt) > 1 && fileExt[0] != '.' {
+		fileExt = "." + fileExt
+	}
+
+	return fileExt
+}
+
 // Функция для генерации уникального идентификатора файла
 func generateFileID() string {
 	const charset = "abcdefghijklmnopqrstuvwxyz" +
@@ -101,18 +641,133 @@ func generateFileID() string {
 }
 
 func main() {
+	var cfg backendConfig
+	flag.StringVar(&cfg.Kind, "backend", "disk", "storage backend: disk, memory, bolt or s3")
+	flag.StringVar(&cfg.Dir, "storage-dir", storagePath, "directory for the disk backend")
+	flag.StringVar(&cfg.BoltPath, "bolt-path", "./storage.db", "database file for the bolt backend")
+	flag.StringVar(&cfg.S3.Endpoint, "s3-endpoint", "", "S3 endpoint host[:port]")
+	flag.StringVar(&cfg.S3.Region, "s3-region", "", "S3 region")
+	flag.StringVar(&cfg.S3.Bucket, "s3-bucket", "", "S3 bucket name")
+	flag.StringVar(&cfg.S3.Prefix, "s3-prefix", "", "key prefix for stored objects")
+	flag.StringVar(&cfg.S3.AccessKey, "s3-access-key", "", "S3 access key (default: AWS/MinIO environment, ~/.aws/credentials or IAM)")
+	flag.StringVar(&cfg.S3.SecretKey, "s3-secret-key", "", "S3 secret key")
+	flag.BoolVar(&cfg.S3.Insecure, "s3-insecure", false, "connect to S3 over plain HTTP")
+	flag.BoolVar(&cfg.S3.PathStyle, "s3-path-style", false, "use path-style bucket addressing")
+	uploadDir := flag.String("upload-dir", "", "directory for unfinished uploads (default: .uploads inside the storage directory for disk, next to the metadata catalog otherwise)")
+	uploadTimeout := flag.Duration("upload-timeout", time.Hour, "remove upload sessions inactive for this long")
+	claimStorage := flag.Bool("claim-storage", false, "use storage that belongs to another metadata catalog; only when no other server uses it")
+	metadataPath := flag.String("metadata-path", "./metadata.db", "database file for the file metadata catalog (ignored by the memory backend)")
+	var retention versionRetention
+	flag.IntVar(&retention.KeepLast, "keep-versions", 0, "keep at most this many previous versions of each file (0: unlimited)")
+	flag.DurationVar(&retention.MaxAge, "version-max-age", 0, "remove previous versions replaced longer ago than this (0: keep forever)")
+	pruneInterval := flag.Duration("version-prune-interval", time.Hour, "how often to remove versions outside the retention policy")
+	trashRetention := flag.Duration("trash-retention", 30*24*time.Hour, "permanently remove files kept in trash longer than this (0: keep forever)")
+	var scrub scrubConfig
+	flag.DurationVar(&scrub.Interval, "scrub-interval", 7*24*time.Hour, "how often to verify stored chunks against their checksums (0: never)")
+	flag.Int64Var(&scrub.Rate, "scrub-rate", 16<<20, "maximum read rate of the integrity check in bytes per second (0: unlimited)")
+	flag.BoolVar(&scrub.Quarantine, "scrub-quarantine", false, "move corrupted chunks to the quarantine folder")
+	var tlsCfg tlsConfig
+	flag.StringVar(&tlsCfg.CertFile, "tls-cert", "", "TLS certificate file; enables TLS together with -tls-key")
+	flag.StringVar(&tlsCfg.KeyFile, "tls-key", "", "TLS private key file")
+	flag.StringVar(&tlsCfg.ClientCAFile, "tls-client-ca", "", "CA certificate file for client certificates; enables mutual TLS")
+	authConfigPath := flag.String("auth-config", "", "JSON file with API keys and JWT settings; enables token authentication")
+	quotaConfigPath := flag.String("quota-config", "", "JSON file with per-user storage quotas (default: unlimited)")
+	devCertDir := flag.String("gen-dev-certs", "", "generate self-signed CA, server and client certificates for development into this directory and exit")
+	devCertHosts := flag.String("dev-cert-hosts", "localhost,127.0.0.1,::1", "comma-separated host names and IP addresses for the development server certificate")
+	flag.Parse()
+
+	if len(*devCertDir) > 0 {
+		if err := generateDevCerts(*devCertDir, strings.Split(*devCertHosts, ",")); err != nil {
+			log.Fatalf("Failed to generate certificates: %v", err)
+		}
+		log.Printf("Development certificates written to %s", *devCertDir)
+		return
+	}
+
+	if *uploadTimeout <= 0 {
+		log.Fatalf("Invalid -upload-timeout %v: must be positive", *uploadTimeout)
+	}
+	if (retention.KeepLast > 0 || retention.MaxAge > 0) && *pruneInterval <= 0 {
+		log.Fatalf("Invalid -version-prune-interval %v: must be positive", *pruneInterval)
+	}
+
+	var opts []grpc.ServerOption
+	if len(tlsCfg.CertFile) > 0 || len(tlsCfg.KeyFile) > 0 || len(tlsCfg.ClientCAFile) > 0 {
+		certs, err := newCertReloader(tlsCfg)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificates: %v", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(certs.config())))
+	}
+	authOpts, err := authServerOptions(*authConfigPath)
+	if err != nil {
+		log.Fatalf("Failed to load authentication config: %v", err)
+	}
+	opts = append(opts, authOpts...)
+	quotas, err := loadQuotaConfig(*quotaConfigPath)
+	if err != nil {
+		log.Fatalf("Failed to load quota config: %v", err)
+	}
+
 	lis, err := net.Listen("tcp", ":50051")
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	s := grpc.NewServer()
-	pb.RegisterFileStorageServer(s, &server{})
+	backend, err := newBackend(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to create storage backend: %v", err)
+	}
 
-	err = os.MkdirAll(storagePath, 0755)
+	// Содержимое хранилища в памяти пропадает при перезапуске, поэтому
+	// и каталог метаданных для него создаётся заново во временной папке
+	if cfg.Kind == "memory" {
+		dir, err := ioutil.TempDir("", "file-storage-")
+		if err != nil {
+			log.Fatalf("Failed to create temporary metadata catalog: %v", err)
+		}
+		*metadataPath = filepath.Join(dir, "metadata.db")
+		log.Printf("Using temporary metadata catalog %s for the memory backend", *metadataPath)
+	}
+
+	meta, err := newMetadataStore(*metadataPath)
+	if err != nil {
+		log.Fatalf("Failed to open metadata catalog: %v", err)
+	}
+
+	// Для дискового хранилища незавершённые загрузки лежат на том же диске,
+	// для остальных - рядом с каталогом метаданных, который открыт только
+	// одним сервером, поэтому серверы не удаляют загрузки друг друга
+	if len(*uploadDir) == 0 {
+		if cfg.Kind == "disk" {
+			*uploadDir = filepath.Join(cfg.Dir, ".uploads")
+		} else {
+			*uploadDir = filepath.Join(filepath.Dir(*metadataPath), ".uploads")
+		}
+	}
+
+	uploads, err := newUploadManager(*uploadDir, *uploadTimeout)
 	if err != nil {
-		log.Fatalf("Failed to create storage directory: %v", err)
+		log.Fatalf("Failed to create upload directory: %v", err)
 	}
+	go uploads.cleanup(context.Background())
+
+	srv := &server{backend: backend, meta: meta, uploads: uploads, locks: newLockManager(), retention: retention, quotas: quotas}
+	if err := srv.prepareStorage(context.Background(), *claimStorage); err != nil {
+		log.Fatalf("Failed to prepare storage: %v", err)
+	}
+	if retention.KeepLast > 0 || retention.MaxAge > 0 {
+		go srv.pruneVersions(context.Background(), *pruneInterval)
+	}
+	if *trashRetention > 0 {
+		go srv.purgeTrash(context.Background(), *trashRetention)
+	}
+	if scrub.Interval > 0 {
+		go srv.scrub(context.Background(), scrub)
+	}
+
+	s := grpc.NewServer(opts...)
+	pb.RegisterFileStorageServer(s, srv)
 
 	log.Printf("Server is listening on %v", lis.Addr())
 	if err := s.Serve(lis); err != nil {
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Поток DownloadFile, который после заголовка ждёт разрешения принять данные
+type stalledDownload struct {
+	grpc.ServerStream
+	header chan struct{}
+	resume chan struct{}
+	data   bytes.Buffer
+}
+
+// Метод для получения контекста потока
+func (s *stalledDownload) Context() context.Context {
+	return context.Background()
+}
+
+// Метод для приёма сообщения потока
+func (s *stalledDownload) Send(msg *pb.DownloadChunk) error {
+	if msg.GetHeader() != nil {
+		close(s.header)
+		<-s.resume
+		return nil
+	}
+	s.data.Write(msg.GetChunk())
+	return nil
+}
+
+func TestDownloadDoesNotBlockWriters(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	x, y := randomContent(20, 1000), randomContent(21, 1000)
+
+	_, err := s.CreateBucket(ctx, &pb.CreateBucketRequest{
+		Name:     "latest",
+		Settings: &pb.BucketSettings{Versioning: pb.Versioning_VERSIONING_DISABLED},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := s.CreateFile(ctx, &pb.CreateFileRequest{Bucket: "latest", File: x})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := &stalledDownload{header: make(chan struct{}), resume: make(chan struct{})}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.DownloadFile(&pb.DownloadFileRequest{Bucket: "latest", Id: f.Id}, stream)
+	}()
+	<-stream.header
+
+	// Пока клиент не принимает данные, файл можно изменить и удалить
+	writes := make(chan error, 1)
+	go func() {
+		if _, err := s.UpdateFile(ctx, &pb.UpdateFileRequest{Bucket: "latest", Id: f.Id, File: y}); err != nil {
+			writes <- err
+			return
+		}
+		if _, err := s.DeleteFile(ctx, &pb.DeleteFileRequest{Bucket: "latest", Id: f.Id}); err != nil {
+			writes <- err
+			return
+		}
+		_, err := s.PurgeFile(ctx, &pb.PurgeFileRequest{Bucket: "latest", Id: f.Id})
+		writes <- err
+	}()
+	select {
+	case err := <-writes:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("writers are blocked by a stalled download")
+	}
+
+	close(stream.resume)
+	if err := <-done; err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	if !bytes.Equal(stream.data.Bytes(), x) {
+		t.Errorf("downloaded %d bytes, want the %d bytes of the content at the start", stream.data.Len(), len(x))
+	}
+	checkRefs(t, s, "download finished after purge", refState{})
+}
+
+func TestReadFileRange(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	x := randomContent(22, 5<<20)
+	size := int64(len(x))
+
+	f, err := s.CreateFile(ctx, &pb.CreateFileRequest{File: x})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		offset, length int64
+		code           codes.Code
+	}{
+		{0, 1 << 20, codes.OK},
+		{size - 100, 0, codes.OK},
+		{size - 100, 1000, codes.OK},
+		{1, maxReadLength, codes.OK},
+		{size, 0, codes.OK},
+		{0, 0, codes.OutOfRange},
+		{0, maxReadLength + 1, codes.OutOfRange},
+		{size + 1, 0, codes.OutOfRange},
+		{-1, 0, codes.OutOfRange},
+	}
+	for _, tt := range tests {
+		resp, err := s.ReadFile(ctx, &pb.ReadFileRequest{Id: f.Id, Offset: tt.offset, Length: tt.length})
+		if status.Code(err) != tt.code {
+			t.Errorf("ReadFile(%d, %d): %v, want %v", tt.offset, tt.length, err, tt.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		end := size
+		if tt.length > 0 && tt.offset+tt.length < end {
+			end = tt.offset + tt.length
+		}
+		if !bytes.Equal(resp.File, x[tt.offset:end]) {
+			t.Errorf("ReadFile(%d, %d) returned %d bytes, want %d", tt.offset, tt.length, len(resp.File), end-tt.offset)
+		}
+	}
+}
+
+// Функция для получения всех страниц списка файлов
+func listAll(t *testing.T, s *server, req *pb.ListFilesRequest) []*pb.FileInfo {
+	t.Helper()
+	var files []*pb.FileInfo
+	for {
+		resp, err := s.ListFiles(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, resp.Files...)
+		if len(resp.NextPageToken) == 0 {
+			return files
+		}
+		req.PageToken = resp.NextPageToken
+	}
+}
+
+func TestListFilesSort(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+
+	files := []struct {
+		name string
+		size int
+	}{
+		{"b.txt", 30},
+		{"a.txt", 10},
+		{"c.txt", 20},
+		{"a.txt", 5},
+	}
+	ids := make(map[string]string)
+	for i, f := range files {
+		resp, err := s.CreateFile(ctx, &pb.CreateFileRequest{Name: f.name, File: randomContent(int64(30+i), f.size)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[resp.Id] = f.name
+	}
+
+	tests := []struct {
+		sortBy     pb.SortBy
+		descending bool
+		key        func(f *pb.FileInfo) string
+		want       string
+	}{
+		{pb.SortBy_SORT_BY_NAME, false, func(f *pb.FileInfo) string { return f.Name }, "a.txt,a.txt,b.txt,c.txt"},
+		{pb.SortBy_SORT_BY_NAME, true, func(f *pb.FileInfo) string { return f.Name }, "c.txt,b.txt,a.txt,a.txt"},
+		{pb.SortBy_SORT_BY_SIZE, false, func(f *pb.FileInfo) string { return strconv.FormatInt(f.Size, 10) }, "5,10,20,30"},
+		{pb.SortBy_SORT_BY_SIZE, true, func(f *pb.FileInfo) string { return strconv.FormatInt(f.Size, 10) }, "30,20,10,5"},
+		{pb.SortBy_SORT_BY_TIME, false, func(f *pb.FileInfo) string { return f.Name }, "b.txt,a.txt,c.txt,a.txt"},
+	}
+	for _, tt := range tests {
+		got := listAll(t, s, &pb.ListFilesRequest{SortBy: tt.sortBy, Descending: tt.descending, PageSize: 1})
+		var keys []string
+		for _, f := range got {
+			if ids[f.Id] != f.Name {
+				t.Errorf("file %s has name %q, want %q", f.Id, f.Name, ids[f.Id])
+			}
+			keys = append(keys, tt.key(f))
+		}
+		if strings.Join(keys, ",") != tt.want {
+			t.Errorf("%v descending=%v: %s, want %s", tt.sortBy, tt.descending, strings.Join(keys, ","), tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Как часто при подключениях проверять, не заменены ли файлы сертификатов
+const certCheckInterval = 10 * time.Second
+
+// Настройки TLS сервера
+type tlsConfig struct {
+	CertFile string
+	KeyFile  string
+	// Сертификат центра, которым подписаны сертификаты клиентов. Если он
+	// задан, клиенты обязаны предъявлять сертификат (взаимный TLS)
+	ClientCAFile string
+}
+
+// Сертификат сервера и центр сертификации клиентов, которые
+// перечитываются после замены файлов, без перезапуска сервера
+type certReloader struct {
+	cfg tlsConfig
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	// Время изменения файлов, из которых загружены сертификаты
+	modTime time.Time
+	checked time.Time
+}
+
+// Функция для создания загрузчика сертификатов по настройкам
+func newCertReloader(cfg tlsConfig) (*certReloader, error) {
+	if len(cfg.CertFile) == 0 || len(cfg.KeyFile) == 0 {
+		return nil, errors.New("both certificate and key files are required")
+	}
+
+	r := &certReloader{cfg: cfg}
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Метод для получения наибольшего времени изменения файлов сертификатов
+func (r *certReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if len(name) == 0 {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Метод для загрузки сертификатов из файлов
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if len(r.cfg.ClientCAFile) > 0 {
+		pem, err := ioutil.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTime = modTime
+	return nil
+}
+
+// Метод для перечитывания сертификатов, если их файлы изменились.
+// При ошибке продолжают использоваться прежние сертификаты: файлы могли
+// быть заменены не все, и при следующей проверке загрузка повторится
+func (r *certReloader) reload() {
+	if time.Since(r.checked) < certCheckInterval {
+		return
+	}
+	r.checked = time.Now()
+
+	modTime, err := r.filesModTime()
+	if err != nil {
+		log.Printf("Failed to check TLS certificates: %v", err)
+		return
+	}
+	if !modTime.After(r.modTime) {
+		return
+	}
+	if err := r.load(modTime); err != nil {
+		log.Printf("Failed to reload TLS certificates: %v", err)
+		return
+	}
+	log.Printf("Reloaded TLS certificate %s", r.cfg.CertFile)
+}
+
+// Метод для получения настроек TLS: сертификаты выбираются
+// при каждом подключении, поэтому замена файлов подхватывается сразу
+func (r *certReloader) config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.reload()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				NextProtos:   []string{"h2"},
+			}
+			if r.clientCAs != nil {
+				cfg.ClientCAs = r.clientCAs
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return cfg, nil
+		},
+	}
+}
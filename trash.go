@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Находится ли файл в корзине
+func (md *fileMetadata) deleted() bool {
+	return !md.DeleteTime.IsZero()
+}
+
+// Метод для перемещения файла в корзину. Содержимое файла и его версий
+// остаётся в хранилище и освобождается только при окончательном удалении
+func (s *server) moveToTrash(md *fileMetadata) error {
+	_, err := s.meta.Update(md.ID, func(md *fileMetadata) (*fileMetadata, error) {
+		if md == nil {
+			return nil, errMetadataNotFound
+		}
+		md.DeleteTime = time.Now()
+		return md, nil
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "Failed to save metadata: %v", err)
+	}
+	return nil
+}
+
+// Метод для получения метаданных файла бакета, в том числе находящегося в корзине
+func (s *server) lookupAnyMetadata(ctx context.Context, bucket, id string) (*fileMetadata, error) {
+	b, err := s.lookupBucket(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := objectName(id, ""); err != nil {
+		return nil, err
+	}
+
+	md, err := s.meta.Get(id)
+	if errors.Is(err, errMetadataNotFound) {
+		return nil, status.Errorf(codes.NotFound, "File not found: %s", id)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to read metadata: %v", err)
+	}
+	if md.bucket() != b.Name {
+		return nil, status.Errorf(codes.NotFound, "File not found: %s", id)
+	}
+	return md, nil
+}
+
+// Метод для получения страницы списка файлов в корзине, начиная с удалённых
+// последними. Файлы читаются по индексу корзины бакета
+func (s *server) ListTrash(ctx context.Context, req *pb.ListTrashRequest) (*pb.ListTrashResponse, error) {
+	size, err := pageSize(req.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	after, err := parsePageToken(req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.lookupBucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListTrashResponse{}
+	err = s.meta.scanIndex(b.Name, trashOrder, after, true, func(key []byte, md *fileMetadata) bool {
+		if !allowed(ctx, md, permRead) {
+			return true
+		}
+		if len(resp.Files) == size {
+			resp.NextPageToken = pageToken(after)
+			return false
+		}
+
+		resp.Files = append(resp.Files, &pb.TrashEntry{
+			Id:         md.ID,
+			Extension:  md.Extension,
+			Name:       md.Name,
+			Size:       md.Size,
+			DeleteTime: timestamppb.New(md.DeleteTime),
+		})
+		after = append(after[:0:0], key...)
+		return true
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to read metadata: %v", err)
+	}
+
+	return resp, nil
+}
+
+// Метод для восстановления файла из корзины
+func (s *server) UndeleteFile(ctx context.Context, req *pb.UndeleteFileRequest) (*pb.UndeleteFileResponse, error) {
+	unlock := s.locks.Lock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupAnyMetadata(ctx, req.Bucket, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permDelete); err != nil {
+		return nil, err
+	}
+	if !md.deleted() {
+		return nil, status.Errorf(codes.FailedPrecondition, "File %s is not in trash", md.ID)
+	}
+
+	_, err = s.meta.Update(md.ID, func(md *fileMetadata) (*fileMetadata, error) {
+		if md == nil {
+			return nil, errMetadataNotFound
+		}
+		md.DeleteTime = time.Time{}
+		return md, nil
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to save metadata: %v", err)
+	}
+
+	return &pb.UndeleteFileResponse{Id: md.ID, Extension: md.Extension}, nil
+}
+
+// Метод для окончательного удаления файла из корзины или минуя её
+func (s *server) PurgeFile(ctx context.Context, req *pb.PurgeFileRequest) (*pb.PurgeFileResponse, error) {
+	unlock := s.locks.Lock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupAnyMetadata(ctx, req.Bucket, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permDelete); err != nil {
+		return nil, err
+	}
+	if err := s.locks.checkLease(md.ID, req.LockToken); err != nil {
+		return nil, err
+	}
+
+	if err := s.purgeFile(ctx, md); err != nil {
+		return nil, err
+	}
+
+	return &pb.PurgeFileResponse{}, nil
+}
+
+// Метод для окончательного удаления файла. Сначала удаляются метаданные,
+// затем освобождаются блобы: при сбое останется лишь неиспользуемый блоб
+func (s *server) purgeFile(ctx context.Context, md *fileMetadata) error {
+	if err := s.meta.Delete(md.ID); err != nil {
+		return status.Errorf(codes.Internal, "Failed to delete metadata: %v", err)
+	}
+	s.releaseFileBlobs(ctx, md)
+	s.locks.dropLease(md.ID)
+
+	return nil
+}
+
+// Метод для периодического удаления файлов, пролежавших в корзине
+// дольше retention
+func (s *server) purgeTrash(ctx context.Context, retention time.Duration) {
+	interval := retention / 2
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	if interval <= 0 {
+		interval = retention
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		files, err := s.meta.List()
+		if err != nil {
+			log.Printf("Failed to list files for trash purging: %v", err)
+			continue
+		}
+		for _, md := range files {
+			if md.deleted() && time.Since(md.DeleteTime) > retention {
+				s.purgeExpiredFile(ctx, md.ID, retention)
+			}
+		}
+	}
+}
+
+// Метод для окончательного удаления файла из корзины, если он
+// по-прежнему там и срок его хранения истёк
+func (s *server) purgeExpiredFile(ctx context.Context, id string, retention time.Duration) {
+	unlock := s.locks.Lock(id)
+	defer unlock()
+
+	md, err := s.meta.Get(id)
+	if err != nil {
+		if !errors.Is(err, errMetadataNotFound) {
+			log.Printf("Failed to read metadata of file %s: %v", id, err)
+		}
+		return
+	}
+	if !md.deleted() || time.Since(md.DeleteTime) <= retention {
+		return
+	}
+
+	if err := s.purgeFile(ctx, md); err != nil {
+		log.Printf("Failed to purge file %s: %v", id, err)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Сессия возобновляемой загрузки
+type uploadSession struct {
+	mu        sync.Mutex
+	id        string
+	path      string
+	extension string
+	name      string
+	size      int64
+	offset    int64
+	updated   time.Time
+	closed    bool
+	// Пользователь, начавший загрузку
+	owner string
+	// Бакет, в который загружается файл
+	bucket *bucketRecord
+	// Существующий файл, содержимое которого заменяется, и условия его записи
+	fileID    string
+	ifMatch   string
+	lockToken string
+}
+
+// Менеджер сессий загрузки
+type uploadManager struct {
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+	dir      string
+	timeout  time.Duration
+}
+
+// Функция для создания менеджера сессий загрузки с данными в каталоге dir.
+// Данные прежних сессий удаляются, так как сами сессии хранятся только в памяти.
+// Удаляются только файлы с именами сессий, остальное содержимое каталога не трогается
+func newUploadManager(dir string, timeout time.Duration) (*uploadManager, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Type().IsRegular() && isSessionID(e.Name()) {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &uploadManager{
+		sessions: make(map[string]*uploadSession),
+		dir:      dir,
+		timeout:  timeout,
+	}, nil
+}
+
+// Функция для проверки, что имя совпадает с идентификатором сессии,
+// созданным generateFileID
+func isSessionID(name string) bool {
+	if len(name) != 16 {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Метод для получения открытой сессии по идентификатору
+func (m *uploadManager) get(ctx context.Context, uploadID string) (*uploadSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[uploadID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Upload session not found: %s", uploadID)
+	}
+	// Продолжить загрузку может только начавший её пользователь
+	if caller, ok := identityFromContext(ctx); ok && caller.Subject != sess.owner {
+		return nil, status.Errorf(codes.PermissionDenied, "Upload session %s belongs to another user", uploadID)
+	}
+	return sess, nil
+}
+
+// Метод для закрытия сессии и удаления её данных
+func (m *uploadManager) remove(sess *uploadSession) {
+	m.mu.Lock()
+	delete(m.sessions, sess.id)
+	m.mu.Unlock()
+
+	sess.closed = true
+	os.Remove(sess.path)
+}
+
+// Метод для периодического удаления брошенных сессий
+func (m *uploadManager) cleanup(ctx context.Context) {
+	interval := m.timeout / 2
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	if interval <= 0 {
+		interval = m.timeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		m.mu.Lock()
+		var sessions []*uploadSession
+		for _, sess := range m.sessions {
+			sessions = append(sessions, sess)
+		}
+		m.mu.Unlock()
+
+		for _, sess := range sessions {
+			sess.mu.Lock()
+			if !sess.closed && time.Since(sess.updated) > m.timeout {
+				m.remove(sess)
+				log.Printf("Upload session %s expired", sess.id)
+			}
+			sess.mu.Unlock()
+		}
+	}
+}
+
+// Метод для начала возобновляемой загрузки
+func (s *server) BeginUpload(ctx context.Context, req *pb.BeginUploadRequest) (*pb.BeginUploadResponse, error) {
+	if req.Size < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid file size: %d", req.Size)
+	}
+	b, err := s.lookupBucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkSize(req.Size); err != nil {
+		return nil, err
+	}
+
+	fileExt := req.Extension
+	if len(fileExt) == 0 {
+		fileExt = filepath.Ext(req.Name)
+	}
+	fileExt = b.extension(fileExt)
+	// Условия замены содержимого проверяются заранее, чтобы не принимать
+	// файл напрасно; при завершении загрузки они проверяются снова
+	if len(req.Id) > 0 {
+		md, _, err := s.lookupForUpdate(ctx, b.Name, req.Id, req.Extension, req.IfMatch, req.LockToken)
+		if err != nil {
+			return nil, err
+		}
+		fileExt = md.Extension
+	}
+
+	uploadID := generateFileID()
+	sess := &uploadSession{
+		id:        uploadID,
+		path:      filepath.Join(s.uploads.dir, uploadID),
+		extension: fileExt,
+		name:      req.Name,
+		size:      req.Size,
+		updated:   time.Now(),
+		bucket:    b,
+		fileID:    req.Id,
+		ifMatch:   req.IfMatch,
+		lockToken: req.LockToken,
+	}
+	if caller, ok := identityFromContext(ctx); ok {
+		sess.owner = caller.Subject
+	}
+
+	f, err := os.Create(sess.path)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create upload: %v", err)
+	}
+	f.Close()
+
+	s.uploads.mu.Lock()
+	s.uploads.sessions[sess.id] = sess
+	s.uploads.mu.Unlock()
+
+	return &pb.BeginUploadResponse{UploadId: sess.id}, nil
+}
+
+// Метод для записи части файла по заданному смещению. Уже принятые байты
+// повторно не записываются, поэтому вызов можно безопасно повторять
+func (s *server) UploadPart(ctx context.Context, req *pb.UploadPartRequest) (*pb.UploadPartResponse, error) {
+	sess, err := s.uploads.get(ctx, req.UploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.closed {
+		return nil, status.Errorf(codes.NotFound, "Upload session not found: %s", req.UploadId)
+	}
+	if req.Offset < 0 || req.Offset > sess.offset {
+		return nil, status.Errorf(codes.OutOfRange, "Invalid offset %d, committed offset is %d", req.Offset, sess.offset)
+	}
+
+	end := req.Offset + int64(len(req.Data))
+	if sess.size > 0 && end > sess.size {
+		return nil, status.Errorf(codes.InvalidArgument, "File is larger than declared size %d", sess.size)
+	}
+	if err := sess.bucket.checkSize(end); err != nil {
+		return nil, err
+	}
+	sess.updated = time.Now()
+
+	// Часть целиком уже была принята ранее
+	if end <= sess.offset {
+		return &pb.UploadPartResponse{CommittedOffset: sess.offset}, nil
+	}
+
+	f, err := os.OpenFile(sess.path, os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to open upload: %v", err)
+	}
+	defer f.Close()
+
+	data := req.Data[sess.offset-req.Offset:]
+	if _, err := f.WriteAt(data, sess.offset); err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to write upload: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to write upload: %v", err)
+	}
+	sess.offset = end
+
+	return &pb.UploadPartResponse{CommittedOffset: sess.offset}, nil
+}
+
+// Метод для получения количества принятых байт
+func (s *server) QueryUpload(ctx context.Context, req *pb.QueryUploadRequest) (*pb.QueryUploadResponse, error) {
+	sess, err := s.uploads.get(ctx, req.UploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.closed {
+		return nil, status.Errorf(codes.NotFound, "Upload session not found: %s", req.UploadId)
+	}
+
+	return &pb.QueryUploadResponse{CommittedOffset: sess.offset, Size: sess.size}, nil
+}
+
+// Метод для завершения загрузки: временный файл разбивается на фрагменты,
+// которые записываются в хранилище, если их там ещё нет
+func (s *server) CommitUpload(ctx context.Context, req *pb.CommitUploadRequest) (*pb.CommitUploadResponse, error) {
+	sess, err := s.uploads.get(ctx, req.UploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.closed {
+		return nil, status.Errorf(codes.NotFound, "Upload session not found: %s", req.UploadId)
+	}
+	if sess.size > 0 && sess.offset != sess.size {
+		return nil, status.Errorf(codes.FailedPrecondition, "Received %d bytes, expected %d", sess.offset, sess.size)
+	}
+
+	want, err := parseChecksums(req.Sha256, req.Crc32C)
+	if err != nil {
+		return nil, err
+	}
+	fileID := sess.fileID
+	if len(fileID) == 0 {
+		fileID = generateFileID()
+		if _, err := objectName(fileID, sess.extension); err != nil {
+			return nil, err
+		}
+		if err := s.checkQuota(sess.owner, sess.bucket, sess.offset, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(sess.path)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to open upload: %v", err)
+	}
+	sum, err := s.putBlob(ctx, f)
+	f.Close()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to commit upload: %v", err)
+	}
+	// Принятые байты повторно не отправляются, поэтому при расхождении
+	// сумм загрузку нужно начинать заново
+	s.uploads.remove(sess)
+	if err := s.verifyContent(ctx, sum, want); err != nil {
+		return nil, err
+	}
+
+	if len(sess.fileID) > 0 {
+		md, warning, err := s.commitReplacement(ctx, sess.bucket.Name, sess.fileID, sess.extension, sess.ifMatch, sess.lockToken, sum)
+		if err != nil {
+			return nil, err
+		}
+		return &pb.CommitUploadResponse{Id: md.ID, Extension: md.Extension, Etag: md.etag(), QuotaWarning: warning}, nil
+	}
+	md, warning, err := s.recordFile(ctx, sess.bucket.Name, fileID, sess.extension, sess.name, sum.content(sess.extension), nil)
+	if err != nil {
+		s.releaseBlob(ctx, sum.Checksum())
+		return nil, err
+	}
+
+	return &pb.CommitUploadResponse{Id: fileID, Extension: sess.extension, Etag: md.etag(), QuotaWarning: warning}, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/NastyNobbo/go-file-storage/storage"
+)
+
+// Сохранённая предыдущая версия файла
+type fileVersion struct {
+	Version     int64     `json:"version"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	CRC32C      string    `json:"crc32c,omitempty"`
+	ContentType string    `json:"content_type"`
+	CreateTime  time.Time `json:"create_time"`
+	// Время, когда версия перестала быть текущей
+	ArchiveTime time.Time `json:"archive_time"`
+}
+
+// Политика хранения версий: сколько последних версий хранить
+// и как долго хранить версию после её замены; 0 - без ограничения
+type versionRetention struct {
+	KeepLast int
+	MaxAge   time.Duration
+}
+
+// Номер текущей версии. У файлов, записанных до появления версий, он равен 1
+func (md *fileMetadata) currentVersion() int64 {
+	if md.Version == 0 {
+		return 1
+	}
+	return md.Version
+}
+
+// Метод для поиска версии файла по номеру
+func (md *fileMetadata) findVersion(version int64) (*fileVersion, bool) {
+	for i := range md.Versions {
+		if md.Versions[i].Version == version {
+			return &md.Versions[i], true
+		}
+	}
+	return nil, false
+}
+
+// Метод для получения текущего содержимого файла в виде предыдущей версии
+// перед его перезаписью. Ссылка на блоб переходит от файла к версии
+func (md *fileMetadata) archive() *fileVersion {
+	return &fileVersion{
+		Version:     md.currentVersion(),
+		Size:        md.Size,
+		SHA256:      md.SHA256,
+		CRC32C:      md.CRC32C,
+		ContentType: md.ContentType,
+		CreateTime:  md.UpdateTime,
+		ArchiveTime: time.Now(),
+	}
+}
+
+// Метод для получения списка версий файла
+func (s *server) ListVersions(ctx context.Context, req *pb.ListVersionsRequest) (*pb.ListVersionsResponse, error) {
+	unlock := s.locks.RLock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupMetadata(ctx, req.Bucket, req.Id, req.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permRead); err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListVersionsResponse{CurrentVersion: md.currentVersion()}
+	for _, v := range md.Versions {
+		resp.Versions = append(resp.Versions, &pb.FileVersion{
+			Version:    v.Version,
+			Size:       v.Size,
+			Sha256:     v.SHA256,
+			CreateTime: timestamppb.New(v.CreateTime),
+		})
+	}
+	resp.Versions = append(resp.Versions, &pb.FileVersion{
+		Version:    md.currentVersion(),
+		Size:       md.Size,
+		Sha256:     md.SHA256,
+		CreateTime: timestamppb.New(md.UpdateTime),
+	})
+
+	return resp, nil
+}
+
+// Метод для восстановления версии файла: текущее содержимое сохраняется
+// как очередная версия, а содержимое выбранной версии становится текущим
+func (s *server) RestoreVersion(ctx context.Context, req *pb.RestoreVersionRequest) (*pb.RestoreVersionResponse, error) {
+	unlock := s.locks.Lock(req.Id)
+	defer unlock()
+
+	md, err := s.lookupMetadata(ctx, req.Bucket, req.Id, req.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, md, permWrite); err != nil {
+		return nil, err
+	}
+	if err := s.locks.checkLease(md.ID, req.LockToken); err != nil {
+		return nil, err
+	}
+	b, err := s.lookupBucket(ctx, req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if req.Version == md.currentVersion() {
+		return &pb.RestoreVersionResponse{Version: md.currentVersion()}, nil
+	}
+	v, ok := md.findVersion(req.Version)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Version %d of file %s not found", req.Version, md.ID)
+	}
+
+	// Содержимое версии уже хранится: на его блоб берётся ещё одна ссылка
+	if err := s.retainBlob(ctx, v.SHA256); err != nil {
+		return nil, backendError(err, "Failed to restore file version")
+	}
+
+	content := fileContent{Size: v.Size, SHA256: v.SHA256, CRC32C: v.CRC32C, ContentType: v.ContentType}
+	md, warning, err := s.replaceContent(ctx, b, md, content)
+	if err != nil {
+		s.releaseBlob(ctx, v.SHA256)
+		return nil, err
+	}
+
+	return &pb.RestoreVersionResponse{Version: md.currentVersion(), QuotaWarning: warning}, nil
+}
+
+// Метод для периодического удаления версий, не подпадающих под политику хранения
+func (s *server) pruneVersions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		files, err := s.meta.List()
+		if err != nil {
+			log.Printf("Failed to list files for version pruning: %v", err)
+			continue
+		}
+		for _, md := range files {
+			if len(s.retention.expired(md.Versions, time.Now())) > 0 {
+				s.pruneFileVersions(ctx, md.ID)
+			}
+		}
+	}
+}
+
+// Метод для удаления устаревших версий одного файла. Сначала версии удаляются
+// из метаданных, затем освобождаются их блобы: при сбое останется лишь
+// неиспользуемый блоб
+func (s *server) pruneFileVersions(ctx context.Context, id string) {
+	unlock := s.locks.Lock(id)
+	defer unlock()
+
+	var expired []fileVersion
+	_, err := s.meta.Update(id, func(md *fileMetadata) (*fileMetadata, error) {
+		if md == nil {
+			return nil, errMetadataNotFound
+		}
+
+		expired = s.retention.expired(md.Versions, time.Now())
+		kept := md.Versions[:0]
+		for _, v := range md.Versions {
+			if !containsVersion(expired, v.Version) {
+				kept = append(kept, v)
+			}
+		}
+		md.Versions = kept
+		return md, nil
+	})
+	if err != nil {
+		log.Printf("Failed to prune versions of file %s: %v", id, err)
+		return
+	}
+
+	for _, v := range expired {
+		s.releaseBlob(ctx, v.SHA256)
+	}
+}
+
+// Метод для отбора версий, которые больше не нужно хранить.
+// Версии в списке упорядочены по возрастанию номера
+func (r versionRetention) expired(versions []fileVersion, now time.Time) []fileVersion {
+	var expired []fileVersion
+	for i, v := range versions {
+		tooMany := r.KeepLast > 0 && i < len(versions)-r.KeepLast
+		tooOld := r.MaxAge > 0 && now.Sub(v.ArchiveTime) > r.MaxAge
+		if tooMany || tooOld {
+			expired = append(expired, v)
+		}
+	}
+	return expired
+}
+
+// Функция для проверки наличия версии в списке
+func containsVersion(versions []fileVersion, version int64) bool {
+	for _, v := range versions {
+		if v.Version == version {
+			return true
+		}
+	}
+	return false
+}